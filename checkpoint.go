@@ -0,0 +1,183 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var checkpointDir = "checkpoints"
+
+// How often the checkpoint is saved while following
+const checkpointInterval = 10 * time.Second
+
+// Checkpoint holds the position of the tail: timestamp of the last displayed entry and IDs of the entries within the
+// tailing time window (needed to avoid duplicates when resuming). Url, index pattern and terms are stored only
+// for reference, checkpoints are looked up by key derived from them.
+type Checkpoint struct {
+	Url           string
+	IndexPattern  string
+	Terms         []string
+	LastTimeStamp string
+	LastIDs       []CheckpointEntry
+	Saved         time.Time
+}
+
+type CheckpointEntry struct {
+	TimeStamp string
+	ID        string
+}
+
+// Returns the key under which the checkpoint for the given configuration (profile, ES instance, indices and query)
+// is stored
+func checkpointKey(config *Configuration) string {
+	hash := sha1.New()
+	hash.Write([]byte(config.SearchTarget.Url + "\n" + config.SearchTarget.IndexPattern + "\n" +
+		strings.Join(config.QueryDefinition.Terms, " ")))
+	if config.Profile != "" {
+		hash.Write([]byte("\nprofile " + config.Profile))
+	}
+	//field filters are only included when set, so that keys of the checkpoints saved without them don't change
+	for _, filter := range config.QueryDefinition.Filters {
+		hash.Write([]byte("\nF " + filter))
+	}
+	for _, field := range config.QueryDefinition.Exists {
+		hash.Write([]byte("\nexists " + field))
+	}
+	if config.QueryDefinition.QueryDSLBody != "" {
+		//the query itself, since the source (e.g. - for standard input) doesn't identify it
+		hash.Write([]byte("\nquery-dsl " + config.QueryDefinition.QueryDSLBody))
+	} else if config.QueryDefinition.QueryDSL != "" {
+		hash.Write([]byte("\nquery-dsl " + config.QueryDefinition.QueryDSL))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func checkpointFile(key string) string {
+	return userHomeDir() + string(os.PathSeparator) + confDir + string(os.PathSeparator) + checkpointDir +
+		string(os.PathSeparator) + key + ".json"
+}
+
+// SaveCheckpoint stores the checkpoint under the given key in ~/.elktail/checkpoints
+func SaveCheckpoint(key string, checkpoint *Checkpoint) error {
+	dirPath := userHomeDir() + string(os.PathSeparator) + confDir + string(os.PathSeparator) + checkpointDir
+	if err := os.MkdirAll(dirPath, 0700); err != nil {
+		return err
+	}
+	checkpointJson, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	//write to temp file first, so that we don't end up with corrupted checkpoint if we get killed while writing
+	file := checkpointFile(key)
+	if err := ioutil.WriteFile(file+".tmp", checkpointJson, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// LoadCheckpoint loads the checkpoint stored under the given key
+func LoadCheckpoint(key string) (*Checkpoint, error) {
+	checkpointBytes, err := ioutil.ReadFile(checkpointFile(key))
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint *Checkpoint
+	if err := json.Unmarshal(checkpointBytes, &checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// Creates checkpoint from the current position of the tail
+func (tail *Tail) checkpoint() *Checkpoint {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+	checkpoint := &Checkpoint{
+		LastTimeStamp: tail.lastTimeStamp,
+		LastIDs:       make([]CheckpointEntry, len(tail.lastIDs)),
+		Saved:         time.Now(),
+	}
+	for i, entry := range tail.lastIDs {
+		checkpoint.LastIDs[i] = CheckpointEntry{TimeStamp: entry.timeStamp, ID: entry.id}
+	}
+	return checkpoint
+}
+
+// Returns whether the position of the tail is saved - only when following or resuming, so that listing historical
+// entries (e.g. using -a and -b) doesn't overwrite the position of the live tail
+func checkpointsEnabled(config *Configuration) bool {
+	return !config.IsListOnly() || config.Resume
+}
+
+// Saves the current position of the tail. Nothing is saved if no entries were displayed or checkpoints are not
+// enabled.
+func (tail *Tail) saveCheckpoint() {
+	if !tail.saveCheckpoints {
+		return
+	}
+	checkpoint := tail.checkpoint()
+	if checkpoint.LastTimeStamp == "" {
+		return
+	}
+	checkpoint.Url = tail.searchTarget.Url
+	checkpoint.IndexPattern = tail.searchTarget.IndexPattern
+	checkpoint.Terms = tail.queryDefinition.Terms
+	if err := SaveCheckpoint(tail.checkpointKey, checkpoint); err != nil {
+		Error.Printf("Failed to save checkpoint: %s\n", err)
+		return
+	}
+	Trace.Printf("Saved checkpoint %s at %s\n", tail.checkpointKey, checkpoint.LastTimeStamp)
+}
+
+// Saves the checkpoint when elktail gets interrupted (e.g. using Ctrl-C) or terminated, after finishing the output
+// of the entries listed so far
+func (tail *Tail) saveCheckpointOnInterrupt() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		tail.closeWriter()
+		tail.saveCheckpoint()
+		os.Exit(interruptExitStatus(sig))
+	}()
+}
+
+// Closes the entry writer, waiting for the entries that are being printed
+func (tail *Tail) closeWriter() {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+	if tail.writer != nil {
+		tail.writer.Close()
+	}
+}
+
+// Returns exit status for the signal elktail was stopped with (128 + signal number, as shells do)
+func interruptExitStatus(sig os.Signal) int {
+	if sig == syscall.SIGTERM {
+		return 143
+	}
+	return 130
+}
+
+// Restores the position of the tail from previously saved checkpoint
+func (tail *Tail) resume(checkpoint *Checkpoint) {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+	tail.lastTimeStamp = checkpoint.LastTimeStamp
+	tail.lastIDs = make([]displayedEntry, len(checkpoint.LastIDs))
+	for i, entry := range checkpoint.LastIDs {
+		tail.lastIDs[i] = displayedEntry{timeStamp: entry.TimeStamp, id: entry.ID}
+	}
+}
@@ -0,0 +1,131 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCheckpointKey(t *testing.T) {
+	config := new(Configuration)
+	config.SearchTarget.Url = "http://localhost:9200"
+	config.SearchTarget.IndexPattern = "logstash-[0-9].*"
+	config.QueryDefinition.Terms = []string{"level:error"}
+	key := checkpointKey(config)
+	tu.AssertEqualsInt(t, 16, len(key))
+	tu.AssertEqualsString(t, key, checkpointKey(config.Copy()))
+
+	config.QueryDefinition.Terms = []string{"level:warn"}
+	if key == checkpointKey(config) {
+		tu.Fail(t, "Expected different checkpoint keys for different queries")
+	}
+
+	key = checkpointKey(config)
+	config.Profile = "prod"
+	if key == checkpointKey(config) {
+		tu.Fail(t, "Expected different checkpoint keys for different profiles")
+	}
+}
+
+func TestListOnlyKeepsCheckpoint(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	home, err := ioutil.TempDir("", "elktail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	config := new(Configuration)
+	config.SearchTarget.Url = "http://localhost:9200"
+	config.QueryDefinition.Terms = []string{"level:error"}
+	if !checkpointsEnabled(config) {
+		tu.Fail(t, "Expected checkpoints to be saved when following")
+	}
+	live := &Tail{searchTarget: &config.SearchTarget, queryDefinition: &config.QueryDefinition,
+		checkpointKey: checkpointKey(config), saveCheckpoints: checkpointsEnabled(config)}
+	live.resume(&Checkpoint{LastTimeStamp: "2016-06-17T15:00:00.500Z"})
+	live.saveCheckpoint()
+
+	//listing historical entries doesn't move the position of the live tail
+	config.QueryDefinition.AfterDateTime = "2016-01-01T00:00:00.000Z"
+	config.QueryDefinition.BeforeDateTime = "2016-01-02T00:00:00.000Z"
+	historical := &Tail{searchTarget: &config.SearchTarget, queryDefinition: &config.QueryDefinition,
+		checkpointKey: checkpointKey(config), saveCheckpoints: checkpointsEnabled(config)}
+	historical.resume(&Checkpoint{LastTimeStamp: "2016-01-01T23:59:59.000Z"})
+	historical.saveCheckpoint()
+
+	loaded, err := LoadCheckpoint(live.checkpointKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "2016-06-17T15:00:00.500Z", loaded.LastTimeStamp)
+
+	config.Resume = true
+	if !checkpointsEnabled(config) {
+		tu.Fail(t, "Expected checkpoints to be saved when resuming")
+	}
+}
+
+func TestSaveAndLoadCheckpoint(t *testing.T) {
+	home, err := ioutil.TempDir("", "elktail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	tail := new(Tail)
+	tail.resume(&Checkpoint{
+		LastTimeStamp: "2016-06-17T15:00:00.500Z",
+		LastIDs: []CheckpointEntry{
+			{TimeStamp: "2016-06-17T15:00:00.100Z", ID: "1"},
+			{TimeStamp: "2016-06-17T15:00:00.500Z", ID: "2"},
+		},
+	})
+	if err := SaveCheckpoint("test", tail.checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "2016-06-17T15:00:00.500Z", loaded.LastTimeStamp)
+	tu.AssertEqualsInt(t, 2, len(loaded.LastIDs))
+	tu.AssertEqualsString(t, "2", loaded.LastIDs[1].ID)
+
+	if _, err := LoadCheckpoint("missing"); err == nil {
+		tu.Fail(t, "Expected error when loading missing checkpoint")
+	}
+}
+
+func TestInterruptClosesOutput(t *testing.T) {
+	tail := dryRunTail()
+	formatter, _ := NewEntryFormatter(&QueryDefinition{Output: outputJson})
+	var out bytes.Buffer
+	tail.writer = newEntryWriter(&out, formatter, true)
+	tail.writer.Write(`{"message": "first"}`)
+
+	//json array listed until the interruption is terminated, even if the listing finished just before it
+	tail.closeWriter()
+	tail.closeWriter()
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("Output is not valid JSON: %s\n%s", err, out.String())
+	}
+	tu.AssertEqualsInt(t, 1, len(entries))
+
+	tu.AssertEqualsInt(t, 130, interruptExitStatus(os.Interrupt))
+	tu.AssertEqualsInt(t, 143, interruptExitStatus(syscall.SIGTERM))
+}
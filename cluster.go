@@ -0,0 +1,269 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Field holding the cluster label in structured output (json, ndjson, logfmt, csv and tsv) when tailing several
+// clusters. Line oriented output is prefixed with the label instead.
+const clusterField = "cluster"
+
+// How often the entries that spent the reorder window in the buffer are printed
+const reorderFlushInterval = 100 * time.Millisecond
+
+// ClusterTail is a tail of one of the clusters tailed at once
+type ClusterTail struct {
+	Label string
+	Tail  *Tail
+}
+
+// Parses cluster given as label=profile or as profile only, in which case profile name is used as the label
+func parseClusterSpec(spec string) (label string, profile string, err error) {
+	label, profile = spec, spec
+	if i := strings.Index(spec, "="); i >= 0 {
+		label, profile = spec[:i], spec[i+1:]
+	}
+	if label == "" {
+		return "", "", fmt.Errorf("Missing cluster label in %s (expected label=profile).", spec)
+	}
+	if err := validateProfileName(profile); err != nil {
+		return "", "", err
+	}
+	return label, profile, nil
+}
+
+// Returns configuration for tailing the cluster - connection and index settings are taken from the cluster's
+// profile, while the query, filters, date range and output settings are the ones given on the command line
+func clusterConfiguration(config *Configuration, profile string) (*Configuration, error) {
+	loaded, err := LoadProfile(profile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load profile %s: %s", profile, err)
+	}
+	clusterConfig := config.Copy()
+	clusterConfig.Profile = profile
+	clusterConfig.SearchTarget = loaded.SearchTarget
+	clusterConfig.User = loaded.User
+	clusterConfig.Password = ""
+	clusterConfig.SSHTunnelParams = loaded.SSHTunnelParams
+	if loaded.QueryDefinition.TimestampField != "" {
+		clusterConfig.QueryDefinition.TimestampField = loaded.QueryDefinition.TimestampField
+	}
+	addClusterField(&clusterConfig.QueryDefinition)
+	return clusterConfig, nil
+}
+
+// Returns whether the entries are output in one of the structured output modes, which get the cluster label as
+// a field instead of a prefix
+func structuredOutput(q *QueryDefinition) bool {
+	return q.Template == "" && q.Output != "" && q.Output != outputFormat
+}
+
+// Makes the cluster label the first of the output fields in structured output. Json output of the whole entries
+// is left as it is, since the label is added to the entry itself.
+func addClusterField(q *QueryDefinition) {
+	if !structuredOutput(q) {
+		return
+	}
+	fields := q.parseFields()
+	if len(fields) == 0 {
+		if q.Output == outputJson || q.Output == outputNdjson {
+			return
+		}
+		fields = q.OutputFields()
+	}
+	q.Fields = strings.Join(append([]string{clusterField}, fields...), ",")
+}
+
+// Entry waiting in the reorder buffer
+type bufferedEntry struct {
+	timeStamp time.Time
+	line      string
+	received  time.Time
+}
+
+// Merges entries coming from several clusters into a single timeline. Entries are held in the buffer for the reorder
+// window, so that entries that arrive from different clusters at slightly different times are printed in timestamp
+// order.
+type reorderBuffer struct {
+	out     *entryWriter
+	window  time.Duration
+	entries []bufferedEntry
+	mutex   sync.Mutex
+}
+
+func newReorderBuffer(out *entryWriter, window time.Duration) *reorderBuffer {
+	return &reorderBuffer{out: out, window: window}
+}
+
+// Add puts the line into the buffer
+func (b *reorderBuffer) Add(timeStamp time.Time, line string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.entries = append(b.entries, bufferedEntry{timeStamp: timeStamp, line: line, received: time.Now()})
+}
+
+// Flush prints the entries (in timestamp order) that have been in the buffer for at least the reorder window, or
+// all of the entries if all is set. Printing stops at the first entry that needs to wait longer, so that the
+// entries that are printed later are never older than the ones already printed.
+func (b *reorderBuffer) Flush(now time.Time, all bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	sort.SliceStable(b.entries, func(i, j int) bool { return b.entries[i].timeStamp.Before(b.entries[j].timeStamp) })
+	printed := 0
+	for _, entry := range b.entries {
+		if !all && now.Sub(entry.received) < b.window {
+			break
+		}
+		b.out.Write(entry.line)
+		printed++
+	}
+	b.entries = b.entries[printed:]
+}
+
+// Makes the tail send its entries, labelled with the cluster label, to the reorder buffer
+func (c *ClusterTail) outputTo(buffer *reorderBuffer) {
+	tail := c.Tail
+	structured := structuredOutput(tail.queryDefinition)
+	tail.output = func(entry map[string]interface{}) {
+		timeStamp := parseElasticTimeStamp(fieldString(entry, tail.queryDefinition.TimestampField))
+		if timeStamp.IsZero() {
+			//entries whose timestamp can't be parsed are ordered by the time they arrived
+			timeStamp = time.Now()
+		}
+		if structured {
+			entry[clusterField] = c.Label
+			buffer.Add(timeStamp, tail.formatLine(entry))
+		} else {
+			buffer.Add(timeStamp, fmt.Sprintf("[%s] %s", c.Label, tail.formatLine(entry)))
+		}
+	}
+}
+
+// Runs the tails of the clusters concurrently, printing their entries merged by timestamp to out. Failure of
+// one of the clusters is reported without stopping the others - when following, failed searches are retried.
+// If a signal is received from interrupts before the tails finish, the tails are stopped and the signal is returned
+// once the entries waiting in the reorder buffer are printed.
+func runClusters(clusters []*ClusterTail, out io.Writer, window time.Duration, follow bool, initialEntries int,
+	interrupts <-chan os.Signal) os.Signal {
+	writer := newEntryWriter(out, clusters[0].Tail.formatter, !follow)
+	buffer := newReorderBuffer(writer, window)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, cluster := range clusters {
+		cluster.Tail.stop = stop
+		cluster.outputTo(buffer)
+		wg.Add(1)
+		go func(cluster *ClusterTail) {
+			defer wg.Done()
+			defer cluster.Tail.saveCheckpoint()
+			err := cluster.Tail.run(follow, initialEntries, func(err error) {
+				Error.Printf("[%s] Error in executing search query, retrying: %s\n", cluster.Label, err)
+			})
+			if err != nil {
+				Error.Printf("[%s] Error in executing search query: %s\n", cluster.Label, err)
+			}
+		}(cluster)
+	}
+	done := make(chan struct{})
+	if follow {
+		go func() {
+			ticker := time.NewTicker(reorderFlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case now := <-ticker.C:
+					buffer.Flush(now, false)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	var interrupt os.Signal
+	select {
+	case <-finished:
+	case interrupt = <-interrupts:
+		stopTails(clusters, stop)
+	}
+	close(done)
+	buffer.Flush(time.Now(), true)
+	writer.Close()
+	return interrupt
+}
+
+// Stops the tails (results of the searches that finish later are discarded, so the positions of the tails stay at
+// the last buffered entries) and waits for the results that are being processed
+func stopTails(clusters []*ClusterTail, stop chan struct{}) {
+	close(stop)
+	for _, cluster := range clusters {
+		cluster.Tail.mutex.Lock()
+		cluster.Tail.mutex.Unlock()
+	}
+}
+
+// ConnectClusters connects to the clusters given in configuration (using their profiles). Clusters that can't be
+// connected to are reported and skipped.
+func ConnectClusters(config *Configuration) []*ClusterTail {
+	clusters := make([]*ClusterTail, 0, len(config.Clusters))
+	for _, spec := range config.Clusters {
+		label, profile, err := parseClusterSpec(spec)
+		if err != nil {
+			Error.Fatalln(err)
+		}
+		clusterConfig, err := clusterConfiguration(config, profile)
+		if err != nil {
+			Error.Printf("[%s] %s\n", label, err)
+			continue
+		}
+		if clusterConfig.User != "" {
+			if clusterConfig.QueryDefinition.QueryDSL == queryDSLStdin {
+				Error.Fatalf("[%s] Query DSL can not be read from standard input when password needs to be "+
+					"entered.\n", label)
+			}
+			fmt.Printf("[%s] ", label)
+		}
+		prepareConnection(clusterConfig)
+		tail, err := newTail(clusterConfig)
+		if err != nil {
+			Error.Printf("[%s] %s\n", label, err)
+			continue
+		}
+		clusters = append(clusters, &ClusterTail{Label: label, Tail: tail})
+	}
+	if len(clusters) == 0 {
+		Error.Fatalln("Could not connect to any of the clusters.")
+	}
+	return clusters
+}
+
+// TailClusters tails the clusters at once, merging their entries by timestamp
+func TailClusters(clusters []*ClusterTail, config *Configuration, follow bool, initialEntries int) {
+	//checkpoints of all of the clusters are saved on interrupt, after the buffered entries are printed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	interrupt := runClusters(clusters, os.Stdout, config.ReorderWindow, follow, initialEntries, signals)
+	if interrupt != nil {
+		for _, cluster := range clusters {
+			cluster.Tail.saveCheckpoint()
+		}
+		os.Exit(interruptExitStatus(interrupt))
+	}
+}
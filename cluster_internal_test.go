@@ -0,0 +1,233 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseClusterSpec(t *testing.T) {
+	label, profile, err := parseClusterSpec("eu=prod-eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "eu", label)
+	tu.AssertEqualsString(t, "prod-eu", profile)
+
+	label, profile, _ = parseClusterSpec("staging")
+	tu.AssertEqualsString(t, "staging", label)
+	tu.AssertEqualsString(t, "staging", profile)
+
+	for _, invalid := range []string{"=prod", "eu=", "eu=../prod"} {
+		if _, _, err := parseClusterSpec(invalid); err == nil {
+			tu.Fail(t, "Expected error for cluster "+invalid)
+		}
+	}
+}
+
+func TestAddClusterField(t *testing.T) {
+	q := &QueryDefinition{Output: outputCsv, Format: "%@timestamp %message"}
+	addClusterField(q)
+	tu.AssertEqualsString(t, "cluster,@timestamp,message", q.Fields)
+
+	q = &QueryDefinition{Output: outputNdjson}
+	addClusterField(q)
+	tu.AssertEqualsString(t, "", q.Fields)
+
+	q = &QueryDefinition{Format: "%message"}
+	addClusterField(q)
+	tu.AssertEqualsString(t, "", q.Fields)
+}
+
+func TestReorderBuffer(t *testing.T) {
+	var out bytes.Buffer
+	buffer := newReorderBuffer(newEntryWriter(&out, &formatStringFormatter{}, false), time.Second)
+	base := time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC)
+	buffer.Add(base.Add(2*time.Second), "third")
+	buffer.Add(base, "first")
+	buffer.Add(base.Add(time.Second), "second")
+
+	//entries are held back for the reorder window
+	buffer.Flush(time.Now(), false)
+	tu.AssertEqualsString(t, "", out.String())
+
+	buffer.Flush(time.Now().Add(time.Second), false)
+	tu.AssertEqualsString(t, "first\nsecond\nthird\n", out.String())
+
+	buffer.Add(base.Add(3*time.Second), "fourth")
+	buffer.Flush(time.Now(), true)
+	tu.AssertEqualsString(t, "first\nsecond\nthird\nfourth\n", out.String())
+}
+
+// Returns tail of the test cluster, searching the given server
+func testClusterTail(t *testing.T, label string, url string) *ClusterTail {
+	client, err := elastic.NewClient(elastic.SetURL(url), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+	tail.searchTarget = &SearchTarget{Url: url, IndexPattern: "logstash-.*"}
+	tail.checkpointKey = label
+	tail.queryDefinition.Format = "%message"
+	tail.formatter, _ = NewEntryFormatter(tail.queryDefinition)
+	tail.highlighter, _ = NewHighlighter(tail.queryDefinition)
+	return &ClusterTail{Label: label, Tail: tail}
+}
+
+func TestRunClusters(t *testing.T) {
+	InitLogging(ioutil.Discard, ioutil.Discard, ioutil.Discard, false)
+	home, err := ioutil.TempDir("", "elktail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	eu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hits": {"total": 2, "hits": [
+			{"_id": "2", "_source": {"@timestamp": "2016-07-01T12:00:03.000Z", "message": "eu second"}},
+			{"_id": "1", "_source": {"@timestamp": "2016-07-01T12:00:01.000Z", "message": "eu first"}}]}}`))
+	}))
+	defer eu.Close()
+	us := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hits": {"total": 1, "hits": [
+			{"_id": "1", "_source": {"@timestamp": "2016-07-01T12:00:02.000Z", "message": "us first"}}]}}`))
+	}))
+	defer us.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	clusters := []*ClusterTail{
+		testClusterTail(t, "eu", eu.URL),
+		testClusterTail(t, "ap", failing.URL),
+		testClusterTail(t, "us", us.URL),
+	}
+	var out bytes.Buffer
+	runClusters(clusters, &out, time.Second, false, 10, nil)
+	tu.AssertEqualsString(t, "[eu] eu first\n[us] us first\n[eu] eu second\n", out.String())
+}
+
+// Writer that can be read while the clusters are being tailed
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// Returns server answering the searches with the given responses in turn (and with no hits once they run out).
+// Empty response makes the search fail.
+func sequenceServer(responses ...string) *httptest.Server {
+	var mutex sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		mutex.Lock()
+		response := `{"hits": {"total": 0, "hits": []}}`
+		if len(responses) > 0 {
+			response, responses = responses[0], responses[1:]
+		}
+		mutex.Unlock()
+		if response == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+}
+
+func TestFollowClusters(t *testing.T) {
+	InitLogging(ioutil.Discard, ioutil.Discard, ioutil.Discard, false)
+	eu := sequenceServer(`{"hits": {"total": 2, "hits": [
+		{"_id": "2", "_source": {"@timestamp": "2016-07-01T12:00:03.000Z", "message": "eu second"}},
+		{"_id": "1", "_source": {"@timestamp": "2016-07-01T12:00:01.000Z", "message": "eu first"}}]}}`)
+	defer eu.Close()
+	//the first search fails, the entry arrives with the retried search, after the entries of the other cluster
+	ap := sequenceServer("", `{"hits": {"total": 1, "hits": [
+		{"_id": "1", "_source": {"@timestamp": "2016-07-01T12:00:02.000Z", "message": "ap first"}}]}}`)
+	defer ap.Close()
+
+	clusters := []*ClusterTail{testClusterTail(t, "eu", eu.URL), testClusterTail(t, "ap", ap.URL)}
+	var out syncBuffer
+	interrupts := make(chan os.Signal, 1)
+	finished := make(chan struct{})
+	go func() {
+		runClusters(clusters, &out, 2*time.Second, true, 10, interrupts)
+		close(finished)
+	}()
+
+	expected := "[eu] eu first\n[ap] ap first\n[eu] eu second\n"
+	for deadline := time.Now().Add(5 * time.Second); out.String() != expected && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+	}
+	interrupts <- os.Interrupt
+	<-finished
+	//entries held in the reorder window are merged by timestamp, even though the retried cluster's entry arrived later
+	tu.AssertEqualsString(t, expected, out.String())
+}
+
+func TestInterruptClusters(t *testing.T) {
+	InitLogging(ioutil.Discard, ioutil.Discard, ioutil.Discard, false)
+	eu := sequenceServer(`{"hits": {"total": 2, "hits": [
+		{"_id": "2", "_source": {"@timestamp": "2016-07-01T12:00:03.000Z", "message": "eu second"}},
+		{"_id": "1", "_source": {"@timestamp": "2016-07-01T12:00:01.000Z", "message": "eu first"}}]}}`)
+	defer eu.Close()
+	cluster := testClusterTail(t, "eu", eu.URL)
+	var out syncBuffer
+	interrupts := make(chan os.Signal, 1)
+	interrupted := make(chan os.Signal, 1)
+	go func() {
+		interrupted <- runClusters([]*ClusterTail{cluster}, &out, time.Minute, true, 10, interrupts)
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); cluster.Tail.checkpoint().LastTimeStamp == "" &&
+		time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tu.AssertEqualsString(t, "", out.String())
+
+	//entries waiting for the reorder window are printed before the checkpoint (already past them) is saved
+	interrupts <- syscall.SIGTERM
+	tu.AssertEqualsString(t, syscall.SIGTERM.String(), (<-interrupted).String())
+	tu.AssertEqualsString(t, "[eu] eu first\n[eu] eu second\n", out.String())
+
+	//results of the searches finished after the interrupt don't move the tail past the printed entries
+	source := json.RawMessage(`{"@timestamp": "2016-07-01T12:00:04.000Z", "message": "eu third"}`)
+	cluster.Tail.processResults(&elastic.SearchResult{Hits: &elastic.SearchHits{
+		Hits: []*elastic.SearchHit{{Id: "3", Source: &source}}}}, true)
+	tu.AssertEqualsString(t, "2016-07-01T12:00:03.000Z", cluster.Tail.checkpoint().LastTimeStamp)
+}
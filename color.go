@@ -0,0 +1,169 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh/terminal"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Supported color modes
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+const ansiReset = "\x1b[0m"
+
+// Regexp matching ANSI escape sequences, used to strip them from (highlighted) values when matching color rules
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// ANSI escape codes for colors available in color rules and templates
+var ansiColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+	"bold":    "1",
+	"dim":     "2",
+	"inverse": "7",
+}
+
+// Colors used for stable per-value coloring. Red and yellow are left out since they are used for errors and warnings.
+var valueColorPalette = []string{"32", "34", "35", "36", "92", "94", "95", "96"}
+
+// Color rules applied if no user specified rule matches - errors are red, warnings yellow and debug entries gray
+var defaultColorRules = []string{
+	`level=error|err|fatal|critical|crit|alert|emerg|emergency|panic|severe:red`,
+	`level=warn|warning:yellow`,
+	`level=debug|trace|finest|finer|fine:gray`,
+	`log.level=error|err|fatal|critical|crit|alert|emerg|emergency|panic|severe:red`,
+	`log.level=warn|warning:yellow`,
+	`log.level=debug|trace:gray`,
+	`severity=error|err|fatal|critical|crit|alert|emerg|emergency:red`,
+	`severity=warn|warning:yellow`,
+	`status=5\d\d:red`,
+	`status=4\d\d:yellow`,
+}
+
+// ColorRule colors the whole entry if the value of the field matches the pattern
+type ColorRule struct {
+	Field   string
+	Pattern *regexp.Regexp
+	Color   string
+}
+
+// Colorizer colors the output according to the color rules and stable per-value coloring of selected fields
+type Colorizer struct {
+	enabled     bool
+	rules       []ColorRule
+	valueFields map[string]bool
+}
+
+// NewColorizer creates colorizer based on query definition's color settings. Colors are enabled in auto mode only
+// if output is a terminal and NO_COLOR environment variable is not set.
+func NewColorizer(q *QueryDefinition) (*Colorizer, error) {
+	enabled, err := colorEnabled(q.Color)
+	if err != nil {
+		return nil, err
+	}
+	colorizer := &Colorizer{enabled: enabled, valueFields: make(map[string]bool)}
+	for _, rule := range append(append([]string{}, q.ColorRules...), defaultColorRules...) {
+		parsed, err := ParseColorRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		colorizer.rules = append(colorizer.rules, *parsed)
+	}
+	for _, field := range strings.Split(q.ColorBy, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			colorizer.valueFields[field] = true
+		}
+	}
+	return colorizer, nil
+}
+
+func colorEnabled(mode string) (bool, error) {
+	switch mode {
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	case "", colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		return terminal.IsTerminal(int(os.Stdout.Fd())), nil
+	}
+	return false, fmt.Errorf("Unknown color mode %s (supported modes are auto, always and never).", mode)
+}
+
+// ParseColorRule parses color rule given as field=pattern:color, e.g. level=error|fatal:red. Pattern is a regular
+// expression which needs to match the whole value of the field (case insensitive).
+func ParseColorRule(rule string) (*ColorRule, error) {
+	eq := strings.Index(rule, "=")
+	colon := strings.LastIndex(rule, ":")
+	if eq <= 0 || colon < eq {
+		return nil, fmt.Errorf("Invalid color rule %s (expected field=pattern:color).", rule)
+	}
+	color := rule[colon+1:]
+	if _, ok := ansiColors[color]; !ok {
+		return nil, fmt.Errorf("Unknown color %s in color rule %s.", color, rule)
+	}
+	pattern, err := regexp.Compile("(?i)^(?:" + rule[eq+1:colon] + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid pattern in color rule %s: %s", rule, err)
+	}
+	return &ColorRule{Field: rule[:eq], Pattern: pattern, Color: color}, nil
+}
+
+// Color wraps the text in ANSI escape codes for the given color (if colors are enabled)
+func (c *Colorizer) Color(color string, text string) string {
+	code, ok := ansiColors[color]
+	if c == nil || !c.enabled || !ok {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + ansiReset
+}
+
+// Value colors the field value with a color derived from the value itself (if stable coloring is enabled for
+// the field), so that the same values always get the same color.
+func (c *Colorizer) Value(field string, value string) string {
+	if c == nil || !c.enabled || !c.valueFields[field] || value == "" {
+		return value
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(value))
+	return "\x1b[" + valueColorPalette[hash.Sum32()%uint32(len(valueColorPalette))] + "m" + value + ansiReset
+}
+
+// Line colors the whole formatted entry according to the first color rule that matches the entry. Colors of the
+// values within the line are preserved.
+func (c *Colorizer) Line(entry map[string]interface{}, line string) string {
+	if c == nil || !c.enabled {
+		return line
+	}
+	for _, rule := range c.rules {
+		value, err := EvaluateValue(entry, rule.Field)
+		if err != nil || !rule.Pattern.MatchString(ansiRegexp.ReplaceAllString(valueString(value), "")) {
+			continue
+		}
+		code := "\x1b[" + ansiColors[rule.Color] + "m"
+		//re-apply the line color after each of the colored values within the line
+		return code + strings.Replace(line, ansiReset, ansiReset+code, -1) + ansiReset
+	}
+	return line
+}
@@ -0,0 +1,51 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"os"
+	"testing"
+)
+
+func TestColorizer(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, true)
+	colorizer, err := NewColorizer(&QueryDefinition{Color: "always", ColorRules: []string{"logger=.*security.*:magenta"}, ColorBy: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "\x1b[31mfailed\x1b[0m", colorizer.Line(map[string]interface{}{"level": "Error"}, "failed"))
+	tu.AssertEqualsString(t, "\x1b[33mnot found\x1b[0m", colorizer.Line(map[string]interface{}{"status": float64(404)}, "not found"))
+	tu.AssertEqualsString(t, "\x1b[35mlogin\x1b[0m",
+		colorizer.Line(map[string]interface{}{"logger": "app.SecurityFilter", "level": "ERROR"}, "login"))
+	tu.AssertEqualsString(t, "ok", colorizer.Line(map[string]interface{}{"level": "INFO"}, "ok"))
+
+	host := colorizer.Value("host", "web-1")
+	tu.AssertEqualsString(t, host, colorizer.Value("host", "web-1"))
+	tu.AssertEqualsString(t, "web-1", colorizer.Value("message", "web-1"))
+	tu.AssertEqualsString(t, "\x1b[31m"+host+"\x1b[31m failed\x1b[0m",
+		colorizer.Line(map[string]interface{}{"level": "error"}, host+" failed"))
+
+	formatter, _ := NewEntryFormatter(&QueryDefinition{Format: "%level %message", Color: "never"})
+	tu.AssertEqualsString(t, "ERROR failed", formatter.Format(map[string]interface{}{"level": "ERROR", "message": "failed"}))
+}
+
+func TestParseColorRule(t *testing.T) {
+	rule, err := ParseColorRule("url=http://.*:blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "url", rule.Field)
+	tu.AssertEqualsString(t, "blue", rule.Color)
+	for _, invalid := range []string{"level:red", "level=error", "level=error:purple", "level=(:red"} {
+		if _, err := ParseColorRule(invalid); err == nil {
+			tu.Fail(t, "Expected error for color rule "+invalid)
+		}
+	}
+	if _, err := NewColorizer(&QueryDefinition{Color: "sometimes"}); err == nil {
+		tu.Fail(t, "Expected error for unknown color mode")
+	}
+}
@@ -0,0 +1,71 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+)
+
+// Bash completion script. Values of -f/--format are completed with %-prefixed field names and values of
+// -t/--timestamp-field with date fields, both taken from `elktail fields` using the connection options present on
+// the command line. Commands are completed using cli's --generate-bash-completion.
+const bashCompletionScript = `# elktail bash completion, load with: source <(elktail completion)
+_elktail_fields() {
+    local i args=()
+    for ((i=1; i < COMP_CWORD-1; i++)); do
+        case "${COMP_WORDS[i]}" in
+            --url|-i|--index-pattern|--profile|--ssh|--ssh-tunnel)
+                args+=("${COMP_WORDS[i]}" "${COMP_WORDS[i+1]}");;
+        esac
+    done
+    elktail "${args[@]}" fields --names-only "$@" </dev/null 2>/dev/null
+}
+
+_elktail() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local field prefix word
+    COMPREPLY=()
+    case "$prev" in
+        -f|--format)
+            if [[ "$cur" == *%* ]]; then
+                prefix="${cur%\%*}%"
+                word="${cur##*%}"
+            elif [[ -z "$cur" ]]; then
+                prefix="%"
+                word=""
+            else
+                return
+            fi
+            while read -r field; do
+                [[ "$field" == "$word"* ]] && COMPREPLY+=("$prefix$field")
+            done < <(_elktail_fields)
+            compopt -o nospace 2>/dev/null
+            return;;
+        -t|--timestamp-field)
+            while read -r field; do
+                [[ "$field" == "$cur"* ]] && COMPREPLY+=("$field")
+            done < <(_elktail_fields --type date)
+            return;;
+    esac
+    if [[ "$cur" != -* ]]; then
+        COMPREPLY=($(compgen -W "$(elktail --generate-bash-completion 2>/dev/null)" -- "$cur"))
+    fi
+}
+
+complete -o default -F _elktail elktail
+`
+
+// Returns the completion command, which prints the bash completion script
+func completionCommand() cli.Command {
+	return cli.Command{
+		Name:  "completion",
+		Usage: "Print bash completion script (load it with: source <(elktail completion))",
+		Action: func(c *cli.Context) {
+			fmt.Print(bashCompletionScript)
+		},
+	}
+}
@@ -9,22 +9,40 @@ import (
 	"runtime"
 	"os"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"github.com/codegangsta/cli"
+	"time"
 )
 
 type SearchTarget struct {
-	Url          string
-	TunnelUrl	 string	`json:"-"`
-	IndexPattern string
+	Url             string
+	TunnelUrl	    string	`json:"-"`
+	IndexPattern    string
+	IndexStrategy   string
+	IndexDateFormat string
 }
 
 type QueryDefinition struct {
 	Terms          []string
+	QueryLanguage  string
+	Filters        []string
+	Exists         []string
 	Format         string
 	TimestampField string
 	AfterDateTime  string  `json:"-"`
 	BeforeDateTime string  `json:"-"`
+	TimeZone       string  `json:"-"`
+	Output         string  `json:"-"`
+	Fields         string  `json:"-"`
+	Template       string  `json:"-"`
+	Color          string  `json:"-"`
+	ColorRules     []string `json:"-"`
+	ColorBy        string  `json:"-"`
+	HighlightMatches string `json:"-"`
+	Highlight      string  `json:"-"`
+	QueryDSL       string  `json:"-"`
+	QueryDSLBody   string  `json:"-"`
 }
 
 type Configuration struct {
@@ -32,6 +50,8 @@ type Configuration struct {
 	QueryDefinition QueryDefinition
 	InitialEntries  int
 	ListOnly        bool	`json:"-"`
+	Follow          bool	`json:"-"`
+	Resume          bool	`json:"-"`
 	User            string
 	Password        string  `json:"-"`
 	Verbose         bool	`json:"-"`
@@ -39,13 +59,17 @@ type Configuration struct {
 	TraceRequests   bool	`json:"-"`
 	SSHTunnelParams string
 	SaveQuery		bool	`json:"-"`
+	Profile         string  `json:"-"`
+	DryRun          bool    `json:"-"`
+	Explain         bool    `json:"-"`
+	Clusters        []string      `json:"-"`
+	ReorderWindow   time.Duration `json:"-"`
 }
 
 var confDir = ".elktail"
-var defaultConfFile = "default.json"
 
 //When changing this array, make sure to also make appropriate changes in CopyConfigRelevantSettingsTo
-var configRelevantFlags = []string{"url", "f", "i", "t", "u", "ssh"}
+var configRelevantFlags = []string{"url", "f", "i", "t", "u", "ssh", "query-language", "index-strategy", "index-date-format"}
 
 
 
@@ -75,63 +99,74 @@ func (c *Configuration) CopyConfigRelevantSettingsTo(dest *Configuration) {
 	dest.SearchTarget.TunnelUrl = c.SearchTarget.TunnelUrl
 	dest.SearchTarget.Url = c.SearchTarget.Url
 	dest.SearchTarget.IndexPattern = c.SearchTarget.IndexPattern
+	dest.SearchTarget.IndexStrategy = c.SearchTarget.IndexStrategy
+	dest.SearchTarget.IndexDateFormat = c.SearchTarget.IndexDateFormat
 	dest.QueryDefinition.Format = c.QueryDefinition.Format
+	dest.QueryDefinition.TimestampField = c.QueryDefinition.TimestampField
+	dest.QueryDefinition.QueryLanguage = c.QueryDefinition.QueryLanguage
 	dest.QueryDefinition.Terms = make([]string, len(c.QueryDefinition.Terms))
 	copy(dest.QueryDefinition.Terms, c.QueryDefinition.Terms)
+	dest.QueryDefinition.Filters = append([]string{}, c.QueryDefinition.Filters...)
+	dest.QueryDefinition.Exists = append([]string{}, c.QueryDefinition.Exists...)
 	dest.User = c.User
 	dest.SSHTunnelParams = c.SSHTunnelParams
 }
 
 func (c *Configuration) CopyNonConfigRelevantSettingsTo(dest *Configuration) {
 	//copy non-config relevant settings
-	dest.QueryDefinition.TimestampField = c.QueryDefinition.TimestampField
 	dest.QueryDefinition.AfterDateTime = c.QueryDefinition.AfterDateTime
 	dest.QueryDefinition.BeforeDateTime = c.QueryDefinition.BeforeDateTime
+	dest.QueryDefinition.TimeZone = c.QueryDefinition.TimeZone
+	dest.QueryDefinition.Output = c.QueryDefinition.Output
+	dest.QueryDefinition.Fields = c.QueryDefinition.Fields
+	dest.QueryDefinition.Template = c.QueryDefinition.Template
+	dest.QueryDefinition.Color = c.QueryDefinition.Color
+	dest.QueryDefinition.ColorRules = c.QueryDefinition.ColorRules
+	dest.QueryDefinition.ColorBy = c.QueryDefinition.ColorBy
+	dest.QueryDefinition.HighlightMatches = c.QueryDefinition.HighlightMatches
+	dest.QueryDefinition.Highlight = c.QueryDefinition.Highlight
+	dest.QueryDefinition.QueryDSL = c.QueryDefinition.QueryDSL
+	dest.QueryDefinition.QueryDSLBody = c.QueryDefinition.QueryDSLBody
 	dest.ListOnly = c.ListOnly
+	dest.Follow = c.Follow
+	dest.Resume = c.Resume
 	dest.InitialEntries = c.InitialEntries
 	dest.Password = c.Password
 	dest.Verbose = c.Verbose
 	dest.MoreVerbose = c.MoreVerbose
 	dest.TraceRequests = c.TraceRequests
+	dest.Profile = c.Profile
+	dest.Clusters = c.Clusters
+	dest.ReorderWindow = c.ReorderWindow
 }
 
 
 
-func (c *Configuration) SaveDefault() {
-	confDirPath := userHomeDir() + string(os.PathSeparator) + confDir;
-	if _, err := os.Stat(confDirPath); os.IsNotExist(err) {
-		//conf directory doesn't exist, let's create it
-		err := os.Mkdir(confDirPath, 0700)
-		if (err != nil) {
-			Error.Printf("Failed to create configuration directory %s, %s\n", confDirPath, err)
-			return
-		}
+//Saves configuration as the named profile (in ~/.elktail/<profile>.json)
+func (c *Configuration) SaveProfile(profile string) error {
+	confDirPath, err := ensureConfDir()
+	if (err != nil) {
+		return fmt.Errorf("Failed to create configuration directory %s, %s", confDirPath, err)
 	}
 	confJson, err := json.MarshalIndent(c, "", "  ")
 	if (err != nil) {
-		Error.Printf("Failed to marshall configuration to json: %s.\n", err)
-		return
+		return fmt.Errorf("Failed to marshall configuration to json: %s.", err)
 	}
-	confFile := confDirPath + string(os.PathSeparator) + defaultConfFile;
+	confFile := profileFile(profile)
 	err = ioutil.WriteFile(confFile, confJson, 0700)
 	if (err != nil) {
-		Error.Printf("Failed to save configuration to file %s, %s\n", confFile, err)
-		return
+		return fmt.Errorf("Failed to save configuration to file %s, %s", confFile, err)
 	}
+	return nil
 }
 
-func LoadDefault() (conf *Configuration, err error)  {
-	confDirPath := userHomeDir() + string(os.PathSeparator) + confDir;
-	if _, err := os.Stat(confDirPath); os.IsNotExist(err) {
-		//conf directory doesn't exist, let's create it
-		err := os.Mkdir(confDirPath, 0700)
-		if (err != nil) {
-			return nil, err
-		}
+//Loads configuration saved as the named profile
+func LoadProfile(profile string) (conf *Configuration, err error)  {
+	if _, err := ensureConfDir(); err != nil {
+		return nil, err
 	}
-	confFile := confDirPath + string(os.PathSeparator) + defaultConfFile;
 	var config *Configuration
-	confBytes, err := ioutil.ReadFile(confFile)
+	confBytes, err := ioutil.ReadFile(profileFile(profile))
 	if (err != nil) {
 		return nil, err
 	}
@@ -142,6 +177,19 @@ func LoadDefault() (conf *Configuration, err error)  {
 	return config, nil
 }
 
+//Returns path of the configuration directory, creating the directory if it doesn't exist
+func ensureConfDir() (string, error) {
+	confDirPath := userHomeDir() + string(os.PathSeparator) + confDir;
+	if _, err := os.Stat(confDirPath); os.IsNotExist(err) {
+		//conf directory doesn't exist, let's create it
+		err := os.Mkdir(confDirPath, 0700)
+		if (err != nil) {
+			return confDirPath, err
+		}
+	}
+	return confDirPath, nil
+}
+
 
 func (config *Configuration) Flags() []cli.Flag {
 	cli.VersionFlag.Usage = "Print the version"
@@ -159,12 +207,97 @@ func (config *Configuration) Flags() []cli.Flag {
 			Usage:       "(*) Message format for the entries - field names are referenced using % sign, for example '%@timestamp %message'",
 			Destination: &config.QueryDefinition.Format,
 		},
+		cli.StringFlag{
+			Name:        "o,output",
+			Value:       "format",
+			Usage:       "Output mode - format (entries formatted according to -f), json, ndjson, logfmt, csv or tsv",
+			Destination: &config.QueryDefinition.Output,
+		},
+		cli.StringFlag{
+			Name:        "fields",
+			Value:       "",
+			Usage:       "Comma separated list of fields for json, ndjson, logfmt, csv and tsv output (example: --fields @timestamp,level,kubernetes.pod.name). Defaults to fields referenced in format",
+			Destination: &config.QueryDefinition.Fields,
+		},
+		cli.StringFlag{
+			Name:        "template",
+			Value:       "",
+			Usage:       "Format the entries using Go text/template, given inline or as @file (example: --template '{{get \"@timestamp\" | local | date \"15:04:05\"}} {{get \"level\" | pad 5}} {{.message}}')",
+			Destination: &config.QueryDefinition.Template,
+		},
+		cli.StringFlag{
+			Name:        "color",
+			Value:       "auto",
+			Usage:       "Color the output - auto (only when writing to terminal and NO_COLOR is not set), always or never",
+			Destination: &config.QueryDefinition.Color,
+		},
+		cli.StringSliceFlag{
+			Name:  "color-rule",
+			Value: &cli.StringSlice{},
+			Usage: "Color the entries whose field matches the pattern, specified as field=pattern:color (example: --color-rule 'logger=.*Security.*:magenta'). May be repeated. Levels and HTTP statuses are colored by default",
+		},
+		cli.StringFlag{
+			Name:        "color-by",
+			Value:       "",
+			Usage:       "Comma separated list of fields whose values are colored so that each distinct value gets its own color (example: --color-by host)",
+			Destination: &config.QueryDefinition.ColorBy,
+		},
+		cli.StringFlag{
+			Name:        "highlight-matches",
+			Value:       "auto",
+			Usage:       "Highlight query matches in the fields referenced in the format - auto (only when colors are enabled), always (matches are marked with ** when colors are disabled) or never",
+			Destination: &config.QueryDefinition.HighlightMatches,
+		},
+		cli.StringFlag{
+			Name:        "highlight",
+			Value:       "",
+			Usage:       "Highlight matches of the given regular expression in the output (example: --highlight 'timeout|refused')",
+			Destination: &config.QueryDefinition.Highlight,
+		},
+		cli.StringFlag{
+			Name:        "query-language",
+			Value:       queryLanguageLucene,
+			Usage:       "(*) Language of the query given as the argument - lucene (query string syntax) or kql (Kibana Query Language)",
+			Destination: &config.QueryDefinition.QueryLanguage,
+		},
+		cli.BoolFlag{
+			Name:  "kql",
+			Usage: "Parse the query given as the argument as Kibana Query Language (KQL) for this invocation (use --query-language to make it the default)",
+		},
+		cli.StringFlag{
+			Name:        "query-dsl",
+			Value:       "",
+			Usage:       "Raw elasticsearch query in JSON, given inline, as @file or - to read it from standard input (example: --query-dsl @query.json). Combined with query terms, field filters and date filters",
+			Destination: &config.QueryDefinition.QueryDSL,
+		},
+		cli.StringSliceFlag{
+			Name:  "F",
+			Value: &cli.StringSlice{},
+			Usage: "Filter the entries by field value - field=value, field!=value, field~regex, field>=n, field>n, field<=n or field<n (example: -F kubernetes.pod.name=web-1 -F status>=500). May be repeated, all filters need to match. Saved with -s",
+		},
+		cli.StringSliceFlag{
+			Name:  "exists",
+			Value: &cli.StringSlice{},
+			Usage: "Only show the entries that have the given field. May be repeated. Saved with -s",
+		},
 		cli.StringFlag{
 			Name:        "i,index-pattern",
 			Value:       "logstash-[0-9].*",
-			Usage:       "(*) Index pattern - elktail will attempt to tail only the latest of logstash's indexes matched by the pattern",
+			Usage:       "(*) Index pattern - elktail will attempt to tail only the latest of logstash's indexes matched by the pattern. Several comma separated patterns may be given, with patterns prefixed by - excluding indices (example: 'app-.*,nginx-.*,-app-test-.*')",
 			Destination: &config.SearchTarget.IndexPattern,
 		},
+		cli.StringFlag{
+			Name:        "index-strategy",
+			Value:       indexStrategyDate,
+			Usage:       "(*) How indices to search are selected - date (by the date in index names, e.g. logstash-2016.01.02), rollover (by the time range of the entries in each index, for ILM rollover indices such as logs-app-000123), alias (index pattern is an alias or data stream name that is searched directly) or wildcard (index pattern is an elasticsearch multi-target expression such as 'logs-*,-logs-old-*', resolved by elasticsearch without listing the indices)",
+			Destination: &config.SearchTarget.IndexStrategy,
+		},
+		cli.StringFlag{
+			Name:        "index-date-format",
+			Value:       defaultIndexDateFormat,
+			Usage:       "(*) Format of the dates in index names, used by the date index strategy - Joda (yyyy, MM, dd, HH, ww, literals in single quotes) or Go (2006, 01, 02, 15) layout. The period each index covers (hour, day, week, month or year) follows from the format (examples: yyyy.MM.dd.HH, yyyy.'w'ww, yyyy.MM)",
+			Destination: &config.SearchTarget.IndexDateFormat,
+		},
 		cli.StringFlag{
 			Name:        "t,timestamp-field",
 			Value:       "@timestamp",
@@ -176,35 +309,78 @@ func (config *Configuration) Flags() []cli.Flag {
 			Usage:       "Just list the results once, do not follow",
 			Destination: &config.ListOnly,
 		},
+		cli.BoolFlag{
+			Name:        "follow",
+			Usage:       "Keep following the results even if the date filter is set. Combined with -a, lists all the results after specified date and then continues tailing",
+			Destination: &config.Follow,
+		},
+		cli.BoolFlag{
+			Name:        "resume",
+			Usage:       "Resume where the previous invocation with the same URL, index pattern and query left off, listing all the entries since then",
+			Destination: &config.Resume,
+		},
 		cli.IntFlag{
 			Name:        "n",
 			Value:       50,
-			Usage:       "Number of entries fetched initially",
+			Usage:       "Number of entries fetched initially. In list-only mode, 0 lists all of the matching entries",
 			Destination: &config.InitialEntries,
 		},
 		cli.StringFlag{
 			Name:        "a,after",
 			Value:       "",
-			Usage:       "List results after specified date (example: -a \"2016-06-17T15:00\")",
+			Usage:       "List results after specified date or relative time (examples: -a \"2016-06-17T15:00\", -a 15m, -a now-2h, -a \"yesterday 18:00\", -a monday)",
 			Destination: &config.QueryDefinition.AfterDateTime,
 		},
 		cli.StringFlag{
 			Name:        "b,before",
 			Value:       "",
-			Usage:       "List results before specified date (example: -b \"2016-06-17T15:00\")",
+			Usage:       "List results before specified date or relative time (examples: -b \"2016-06-17T15:00\", -b 1h, -b today)",
 			Destination: &config.QueryDefinition.BeforeDateTime,
 		},
+		cli.StringFlag{
+			Name:        "tz",
+			Value:       "",
+			Usage:       "Time zone in which dates given with -a and -b are interpreted (example: --tz Europe/Zagreb, --tz Local). Defaults to UTC",
+			Destination: &config.QueryDefinition.TimeZone,
+		},
 		cli.BoolFlag{
 			Name:        "s",
-			Usage:       "Save query terms - next invocation of elktail (without parameters) will use saved query terms. Any additional terms specified will be applied with AND operator to saved terms",
+			Usage:       "Save query terms and field filters - next invocation of elktail (without parameters) will use saved query terms and filters. Any additional terms and filters specified will be applied with AND operator to saved ones",
 			Destination: &config.SaveQuery,
 		},
+		cli.StringFlag{
+			Name:        "profile",
+			Value:       "",
+			Usage:       "Name of the connection profile to use or save (*) options to. If not specified, default profile is used (see 'elktail profile')",
+			Destination: &config.Profile,
+		},
 		cli.StringFlag{
 			Name:        "u",
 			Value:       "",
 			Usage:       "(*) Username for http basic auth, password is supplied over password prompt",
 			Destination: &config.User,
 		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Print the selected indices, sort, size and query body of the search instead of running it",
+			Destination: &config.DryRun,
+		},
+		cli.BoolFlag{
+			Name:        "explain",
+			Usage:       "Print the search like --dry-run (to stderr), validate the query using elasticsearch's _validate/query API and print its explanation before tailing. Exits with error if query is not valid",
+			Destination: &config.Explain,
+		},
+		cli.StringSliceFlag{
+			Name:  "cluster",
+			Value: &cli.StringSlice{},
+			Usage: "Tail several clusters at once, given as label=profile (or just profile, which is then used as the label). Each cluster is connected to using the URL, user, SSH tunnel and index settings saved in its profile, and the entries are merged by timestamp with each line prefixed by the cluster label. May be repeated (example: --cluster eu=prod-eu --cluster us=prod-us)",
+		},
+		cli.DurationFlag{
+			Name:        "reorder-window",
+			Value:       2 * time.Second,
+			Usage:       "How long entries from several clusters are held back so that they can be printed in timestamp order",
+			Destination: &config.ReorderWindow,
+		},
 		cli.StringFlag{
 			Name:        "ssh,ssh-tunnel",
 			Value:       "",
@@ -232,17 +408,42 @@ func (config *Configuration) Flags() []cli.Flag {
 }
 
 //Elktail will work in list-only (no follow) mode if appropriate flag is set or if query has date-time filtering enabled
+//(unless following is explicitly requested)
 func (c *Configuration) IsListOnly() bool {
-	return c.ListOnly || c.QueryDefinition.IsDateTimeFiltered()
+	return c.ListOnly || (c.QueryDefinition.IsDateTimeFiltered() && !c.Follow)
 }
 
 func (q *QueryDefinition) IsDateTimeFiltered() bool {
 	return q.AfterDateTime != "" || q.BeforeDateTime != ""
 }
 
-func IsConfigRelevantFlagSet(c *cli.Context) bool {
+//Resolves (possibly relative) after and before date-time expressions into absolute UTC timestamps. Expressions
+//without explicit time zone are interpreted in the query definition's time zone (UTC if not set).
+func (q *QueryDefinition) ResolveDateTimes(now time.Time) error {
+	loc := time.UTC
+	if q.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(q.TimeZone)
+		if err != nil {
+			return err
+		}
+	}
+	for _, dateTime := range []*string{&q.AfterDateTime, &q.BeforeDateTime} {
+		if *dateTime == "" {
+			continue
+		}
+		resolved, err := ParseTimeExpression(*dateTime, now, loc)
+		if err != nil {
+			return err
+		}
+		*dateTime = formatElasticTimeStamp(resolved.UTC())
+	}
+	return nil
+}
+
+func IsConfigRelevantFlagSet(isSet func(name string) bool) bool {
 	for _, flag := range configRelevantFlags {
-		if c.IsSet(flag) {
+		if isSet(flag) {
 			return true
 		}
 	}
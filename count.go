@@ -0,0 +1,43 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"os"
+)
+
+// Count returns the number of entries in the selected indices matching the query, filters and date range
+func (tail *Tail) Count() (int64, error) {
+	count := tail.client.Count(tail.indices...).Query(tail.buildSearchQuery())
+	if tail.lenientIndices {
+		count = count.IgnoreUnavailable(true).AllowNoIndices(true)
+	}
+	return count.Do(context.Background())
+}
+
+// Returns the count command, which prints the number of matching entries. Like grep, it exits with status 1 if
+// there are no matching entries, so it can be used in scripts.
+func countCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:      "count",
+		Usage:     "Print the number of entries matching the query, filters and date range (exits with status 1 if there are none)",
+		ArgsUsage: "[query-string]",
+		Action: func(c *cli.Context) {
+			prepareConfiguration(config, globalFlags(c), c.Args())
+			count, err := NewTail(config).Count()
+			if err != nil {
+				Error.Fatalln("Error in executing count query.", err)
+			}
+			fmt.Println(count)
+			if count == 0 {
+				os.Exit(1)
+			}
+		},
+	}
+}
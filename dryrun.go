@@ -0,0 +1,141 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"io"
+	"strings"
+)
+
+// Search request that the tail runs first, as shown by --dry-run and --explain
+type plannedSearch struct {
+	description string
+	sort        string
+	size        string
+	query       elastic.Query
+}
+
+// How the entries are paged when exporting, see export
+const exportPaging = "paged using search_after within a point in time (or using scroll on clusters without point " +
+	"in time support)"
+
+// Returns the first search request the tail is going to run, as decided by nextSearch
+func (tail *Tail) plannedSearch(follow bool, initialEntries int) plannedSearch {
+	field := tail.queryDefinition.TimestampField
+	pagingSort := fmt.Sprintf("%s asc, %s asc", field, tiebreakerField)
+	exportSort := fmt.Sprintf("%s asc (tiebreaker: _shard_doc within point in time, %s with scroll)", field,
+		tiebreakerField)
+	exportPages := fmt.Sprintf("%d per page", exportPageSize)
+	switch tail.nextSearch(follow, initialEntries) {
+	case searchFollowUp:
+		return plannedSearch{
+			description: "Resuming from checkpoint - all entries since the last listed one, paged using search_after",
+			sort:        pagingSort,
+			size:        fmt.Sprintf("%d per page", followPageSize),
+			query:       tail.buildTimestampFilteredQuery(),
+		}
+	case searchListSince:
+		return plannedSearch{
+			description: "Listing all matching entries, " + exportPaging,
+			sort:        exportSort,
+			size:        exportPages,
+			query:       tail.buildSearchQuery(),
+		}
+	case searchExport:
+		description := "Listing all matching entries, " + exportPaging
+		if initialEntries > 0 && tail.order {
+			description = fmt.Sprintf("Listing first %d matching entries, %s", initialEntries, exportPaging)
+		} else if initialEntries > 0 {
+			description = fmt.Sprintf("Listing last %d matching entries, %s - first page is found by paging in "+
+				"descending order without fetching the entries", initialEntries, exportPaging)
+		}
+		return plannedSearch{
+			description: description,
+			sort:        exportSort,
+			size:        exportPages,
+			query:       tail.buildSearchQuery(),
+		}
+	}
+	order := "desc"
+	if tail.order {
+		order = "asc"
+	}
+	return plannedSearch{
+		description: fmt.Sprintf("Fetching %d matching entries", initialEntries),
+		sort:        field + " " + order,
+		size:        fmt.Sprintf("%d", initialEntries),
+		query:       tail.buildSearchQuery(),
+	}
+}
+
+// DryRun prints the indices, sort, size and query body of the first search the tail is going to run (and describes
+// the follow up searches when following), without running it
+func (tail *Tail) DryRun(out io.Writer, follow bool, initialEntries int) {
+	search := tail.plannedSearch(follow, initialEntries)
+	fmt.Fprintf(out, "%s\n", search.description)
+	fmt.Fprintf(out, "Indices: %s\n", strings.Join(tail.indices, ", "))
+	fmt.Fprintf(out, "Sort: %s\n", search.sort)
+	fmt.Fprintf(out, "Size: %s\n", search.size)
+	source := elastic.NewSearchSource().Query(search.query)
+	if highlight := tail.highlighter.SearchHighlight(); highlight != nil {
+		source = source.Highlight(highlight)
+	}
+	body, err := source.Source()
+	if err == nil {
+		var bodyJson []byte
+		if bodyJson, err = json.MarshalIndent(body, "", "  "); err == nil {
+			fmt.Fprintf(out, "Query body:\n%s\n", bodyJson)
+		}
+	}
+	if err != nil {
+		Error.Printf("Failed to serialize query: %s\n", err)
+	}
+	if follow {
+		fmt.Fprintf(out, "Follow up searches additionally filter entries with %s >= (timestamp of the last listed "+
+			"entry - %dms), excluding the already listed entries by ID, paged using search_after (%d per page)\n",
+			tail.queryDefinition.TimestampField, tailingTimeWindow, followPageSize)
+	}
+}
+
+// Explain validates the query of the first search using elasticsearch's _validate/query API and prints how
+// elasticsearch interprets it. Returns error describing the problem if the query is not valid.
+func (tail *Tail) Explain(out io.Writer, follow bool, initialEntries int) error {
+	explain := true
+	validate := tail.client.Validate(tail.indices...).
+		Query(tail.plannedSearch(follow, initialEntries).query).
+		Explain(&explain)
+	if tail.lenientIndices {
+		validate = validate.IgnoreUnavailable(true).AllowNoIndices(true)
+	}
+	response, err := validate.Do(context.Background())
+	if err != nil {
+		return err
+	}
+	errors := make([]string, 0)
+	for _, item := range response.Explanations {
+		explanation, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		index := valueString(explanation["index"])
+		if message, ok := explanation["error"]; ok {
+			errors = append(errors, fmt.Sprintf("%s: %s", index, valueString(message)))
+		} else {
+			fmt.Fprintf(out, "Explanation (%s): %s\n", index, valueString(explanation["explanation"]))
+		}
+	}
+	if !response.Valid {
+		if len(errors) == 0 {
+			return fmt.Errorf("Query is not valid.")
+		}
+		return fmt.Errorf("Query is not valid:\n%s", strings.Join(errors, "\n"))
+	}
+	return nil
+}
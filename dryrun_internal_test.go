@@ -0,0 +1,101 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func dryRunTail() *Tail {
+	tail := new(Tail)
+	tail.queryDefinition = &QueryDefinition{Terms: []string{"level:error"}, TimestampField: "@timestamp"}
+	tail.query = elastic.NewQueryStringQuery("level:error")
+	tail.indices = []string{"logstash-2016.07.01", "logstash-2016.07.02"}
+	return tail
+}
+
+func TestDryRun(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	tail := dryRunTail()
+	var out bytes.Buffer
+	tail.DryRun(&out, false, 50)
+	tu.AssertEqualsString(t, `Fetching 50 matching entries
+Indices: logstash-2016.07.01, logstash-2016.07.02
+Sort: @timestamp desc
+Size: 50
+Query body:
+{
+  "query": {
+    "query_string": {
+      "query": "level:error"
+    }
+  }
+}
+`, out.String())
+
+	out.Reset()
+	tail.DryRun(&out, true, 50)
+	if !strings.Contains(out.String(), "Follow up searches additionally filter entries with @timestamp >=") {
+		tu.Fail(t, "Expected description of follow up searches, got "+out.String())
+	}
+
+	tu.AssertEqualsString(t, "@timestamp asc (tiebreaker: _shard_doc within point in time, _uid with scroll)",
+		tail.plannedSearch(false, 0).sort)
+	tu.AssertEqualsString(t, "1000 per page", tail.plannedSearch(false, 5000).size)
+	tail.order = true
+	tu.AssertEqualsString(t, "Listing all matching entries, paged using search_after within a point in time "+
+		"(or using scroll on clusters without point in time support)", tail.plannedSearch(true, 50).description)
+	tu.AssertEqualsString(t, "Listing first 5000 matching entries, paged using search_after within a point in time "+
+		"(or using scroll on clusters without point in time support)", tail.plannedSearch(false, 5000).description)
+
+	//plan follows the search the tail runs next, e.g. follow up query when resuming from checkpoint
+	tail.resume(&Checkpoint{LastTimeStamp: "2016-07-01T12:00:00.000Z"})
+	tu.AssertEqualsInt(t, int(searchFollowUp), int(tail.nextSearch(false, 50)))
+	tu.AssertEqualsString(t, "1000 per page", tail.plannedSearch(false, 50).size)
+}
+
+func TestExplain(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	valid := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/_validate/query") {
+			w.Write([]byte(`{}`))
+			return
+		}
+		if valid {
+			w.Write([]byte(`{"valid": true, "explanations": [{"index": "logstash-2016.07.01", "valid": true, "explanation": "level:error"}]}`))
+		} else {
+			w.Write([]byte(`{"valid": false, "explanations": [{"index": "logstash-2016.07.01", "valid": false, "error": "Cannot parse 'level:(error'"}]}`))
+		}
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+
+	var out bytes.Buffer
+	if err := tail.Explain(&out, false, 50); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "Explanation (logstash-2016.07.01): level:error\n", out.String())
+
+	valid = false
+	err = tail.Explain(&out, false, 50)
+	if err == nil {
+		t.Fatal("Expected error for invalid query")
+	}
+	tu.AssertEqualsString(t, "Query is not valid:\nlogstash-2016.07.01: Cannot parse 'level:(error'", err.Error())
+}
@@ -18,6 +18,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,12 +26,25 @@ import (
 // Tail is a structure that holds data necessary to perform tailing.
 //
 type Tail struct {
-	client          *elastic.Client  //elastic search client that we'll use to contact EL
-	queryDefinition *QueryDefinition //structure containing query definition and formatting
-	indices         []string         //indices to search through
-	lastTimeStamp   string           //timestamp of the last result
-	lastIDs         []displayedEntry //result IDs that we fetched in the last query, used to avoid duplicates when using tailing query time window
-	order           bool             //search order - true = ascending (may be reversed in case date-after filtering)
+	client          *elastic.Client                    //elastic search client that we'll use to contact EL
+	queryDefinition *QueryDefinition                   //structure containing query definition and formatting
+	indices         []string                           //indices to search through
+	lastTimeStamp   string                             //timestamp of the last result
+	lastIDs         []displayedEntry                   //result IDs that we fetched in the last query, used to avoid duplicates when using tailing query time window
+	order           bool                               //search order - true = ascending (may be reversed in case date-after filtering)
+	searchTarget    *SearchTarget                      //ES instance and index pattern we're tailing, used for reference in checkpoints
+	checkpointKey   string                             //key under which the checkpoint (position of the tail) is saved
+	saveCheckpoints bool                               //whether the checkpoint is saved, see checkpointsEnabled
+	formatter       EntryFormatter                     //formats the entries for output
+	highlighter     *Highlighter                       //highlights query matches in the output, nil if highlighting is disabled
+	fieldFilters    []FieldFilter                      //filters given with -F and --exists flags
+	query           elastic.Query                      //query built from the query terms or query DSL, before filters are applied
+	lenientIndices  bool                               //indices are a wildcard expression resolved by ES, unavailable indices are ignored
+	output          func(entry map[string]interface{}) //receives the entries instead of printing them, if set
+	writer          *entryWriter                       //writes the entries to standard output, set when the tail is started
+	listedSince     bool                               //all entries since the date-after date were listed, even if there were none
+	stop            chan struct{}                      //following stops when closed, nil if the tail follows until the program exits
+	mutex           sync.Mutex                         //guards last timestamp and IDs, which are read when saving checkpoint on interrupt
 }
 
 type displayedEntry struct {
@@ -49,12 +63,33 @@ const dateFormatDMY = "2006-01-02"
 const dateFormatFull = "2006-01-02T15:04:05.999Z07:00"
 const tailingTimeWindow = 500
 
-// NewTail creates a new Tailer using configuration
-func NewTail(configuration *Configuration) *Tail {
-	tail := new(Tail)
+// Delay before the search is retried after a failure (when failures are not fatal)
+const retryDelay = 5 * time.Second
 
-	var client *elastic.Client
-	var err error
+// Number of entries fetched per page when following. Follow up queries page through all of the new entries
+// using search_after, so this only affects the number of requests made, not the number of entries displayed.
+const followPageSize = 1000
+
+// Number of entries fetched per page when exporting (listing more entries than it is practical or possible to
+// fetch with a single query, e.g. because of elasticsearch's index.max_result_window limit)
+const exportPageSize = 1000
+
+// Field used to break ties between entries with equal timestamps when paging with search_after
+// (_id is not sortable in elasticsearch 5.x, _uid is).
+const tiebreakerField = "_uid"
+
+// NewClient creates elasticsearch client connected to the configured URL (or to the SSH tunnel if it's started).
+// Adds http:// prefix and default port to the URL if they are not specified.
+func NewClient(configuration *Configuration) *elastic.Client {
+	client, err := newClient(configuration)
+	if err != nil {
+		Error.Fatalln(err)
+	}
+	return client
+}
+
+// Same as NewClient, but returns error instead of exiting if the client can't connect
+func newClient(configuration *Configuration) (*elastic.Client, error) {
 	var url = configuration.SearchTarget.Url
 	if !strings.HasPrefix(url, "http") {
 		url = "http://" + url
@@ -88,16 +123,69 @@ func NewTail(configuration *Configuration) *Tail {
 			elastic.SetTraceLog(Trace))
 	}
 
-	client, err = elastic.NewClient(defaultOptions...)
+	client, err := elastic.NewClient(defaultOptions...)
 
 	if err != nil {
-		Error.Fatalf("Could not connect Elasticsearch client to %s: %s.", url, err)
+		return nil, fmt.Errorf("Could not connect Elasticsearch client to %s: %s.", url, err)
+	}
+	return client, nil
+}
+
+// NewTail creates a new Tailer using configuration
+func NewTail(configuration *Configuration) *Tail {
+	tail, err := newTail(configuration)
+	if err != nil {
+		Error.Fatalln(err)
+	}
+	return tail
+}
+
+// Same as NewTail, but returns error instead of exiting if the tail can't be created (e.g. because elasticsearch
+// is not reachable)
+func newTail(configuration *Configuration) (*Tail, error) {
+	tail := new(Tail)
+
+	var err error
+	tail.client, err = newClient(configuration)
+	if err != nil {
+		return nil, err
 	}
-	tail.client = client
 
 	tail.queryDefinition = &configuration.QueryDefinition
+	tail.formatter, err = NewEntryFormatter(tail.queryDefinition)
+	if err != nil {
+		return nil, err
+	}
+	tail.highlighter, err = NewHighlighter(tail.queryDefinition)
+	if err != nil {
+		return nil, err
+	}
+	tail.fieldFilters, err = tail.queryDefinition.ParseFieldFilters()
+	if err != nil {
+		return nil, err
+	}
+	tail.query, err = tail.queryDefinition.BaseQuery()
+	if err != nil {
+		return nil, err
+	}
+	tail.searchTarget = &configuration.SearchTarget
+	tail.checkpointKey = checkpointKey(configuration)
+	tail.saveCheckpoints = checkpointsEnabled(configuration)
 
-	tail.selectIndices(configuration)
+	if configuration.Resume {
+		checkpoint, err := LoadCheckpoint(tail.checkpointKey)
+		if err != nil {
+			Error.Printf("Could not load checkpoint to resume from, starting from the latest entries: %s\n", err)
+		} else {
+			Info.Printf("Resuming from checkpoint saved at %s, last entry timestamp: %s", checkpoint.Saved,
+				checkpoint.LastTimeStamp)
+			tail.resume(checkpoint)
+		}
+	}
+
+	if err := tail.selectIndices(configuration); err != nil {
+		return nil, err
+	}
 
 	//If we're date filtering on start date, then the sort needs to be ascending
 	if configuration.QueryDefinition.AfterDateTime != "" {
@@ -105,92 +193,397 @@ func NewTail(configuration *Configuration) *Tail {
 	} else {
 		tail.order = false //descending
 	}
-	return tail
+	return tail, nil
 }
 
 // Selects appropriate indices in EL based on configuration. This basically means that if query is date filtered,
-// then it attempts to select indices in the filtered date range, otherwise it selects the last index.
-func (tail *Tail) selectIndices(configuration *Configuration) {
+// then it attempts to select indices in the filtered date range, otherwise it selects the last index. When resuming
+// from a checkpoint, indices since the checkpoint are selected. Aliases, data streams and wildcard expressions are
+// searched directly. Returns error if the indices can't be fetched.
+func (tail *Tail) selectIndices(configuration *Configuration) error {
+	var err error
+	switch configuration.SearchTarget.IndexStrategy {
+	case indexStrategyAlias:
+		tail.indices = []string{configuration.SearchTarget.IndexPattern}
+	case indexStrategyWildcard:
+		tail.indices = []string{configuration.SearchTarget.IndexPattern}
+		tail.lenientIndices = true
+	case indexStrategyRollover:
+		err = tail.selectRolloverIndices(configuration)
+	default:
+		err = tail.selectDatedIndices(configuration)
+	}
+	if err != nil {
+		return err
+	}
+	Info.Printf("Using indices: %s", tail.indices)
+	return nil
+}
+
+// Selects indices by the dates in their names (logstash's one-per-day indices by default, see --index-date-format)
+func (tail *Tail) selectDatedIndices(configuration *Configuration) error {
 	indices, err := tail.client.IndexNames()
 	if err != nil {
-		Error.Fatalln("Could not fetch available indices.", err)
+		return fmt.Errorf("Could not fetch available indices: %s", err)
+	}
+	dateFormat, err := ParseIndexDateFormat(configuration.SearchTarget.IndexDateFormat)
+	if err != nil {
+		return fmt.Errorf("Invalid index date format: %s", err)
 	}
 
-	if configuration.QueryDefinition.IsDateTimeFiltered() {
+	if configuration.QueryDefinition.IsDateTimeFiltered() || tail.lastTimeStamp != "" {
 		startDate := configuration.QueryDefinition.AfterDateTime
 		endDate := configuration.QueryDefinition.BeforeDateTime
+		if startDate == "" && tail.lastTimeStamp != "" {
+			startDate = tail.lastTimeStamp
+		}
 		if startDate == "" && endDate != "" {
-			lastIndex := findLastIndex(indices, configuration.SearchTarget.IndexPattern)
-			lastIndexDate := extractYMDDate(lastIndex, ".")
-			if lastIndexDate.Before(extractYMDDate(endDate, "-")) {
-				startDate = lastIndexDate.Format(dateFormatDMY)
-			} else {
-				startDate = endDate
+			//start from the earliest of the last indices, so that the latest index of each pattern is included
+			startDate = endDate
+			lastIndices, err := findLastIndices(indices, configuration.SearchTarget.IndexPattern)
+			if err != nil {
+				return err
+			}
+			for _, lastIndex := range lastIndices {
+				lastIndexStart, _, err := dateFormat.Period(lastIndex)
+				if err != nil {
+					return indexDateError(err)
+				}
+				start, err := parseRangeDate(startDate)
+				if err != nil {
+					return err
+				}
+				if lastIndexStart.Before(start) {
+					startDate = formatElasticTimeStamp(lastIndexStart)
+				}
 			}
 		}
 		if endDate == "" {
-			endDate = time.Now().Format(dateFormatDMY)
+			endDate = formatElasticTimeStamp(time.Now().UTC())
+		}
+		tail.indices, err = findIndicesForDateRange(indices, configuration.SearchTarget.IndexPattern, dateFormat,
+			startDate, endDate)
+		if err != nil {
+			return err
 		}
-		tail.indices = findIndicesForDateRange(indices, configuration.SearchTarget.IndexPattern, startDate, endDate)
 
 	} else {
-		index := findLastIndex(indices, configuration.SearchTarget.IndexPattern)
-		result := [...]string{index}
-		tail.indices = result[:]
+		tail.indices, err = findLastIndices(indices, configuration.SearchTarget.IndexPattern)
 	}
-	Info.Printf("Using indices: %s", tail.indices)
+	return err
 }
 
 // Start the tailer
 func (tail *Tail) Start(follow bool, initialEntries int) {
-	result, err := tail.initialSearch(initialEntries)
-	if err != nil {
+	tail.saveCheckpointOnInterrupt()
+	defer tail.saveCheckpoint()
+
+	tail.writer = newEntryWriter(os.Stdout, tail.formatter, !follow)
+	if err := tail.run(follow, initialEntries, nil); err != nil {
 		Error.Fatalln("Error in executing search query.", err)
 	}
-	tail.processResults(result)
+	tail.closeWriter()
+}
+
+// Runs the searches, listing the initial entries and following the new ones if follow is set. Returns the first
+// error, unless onError is given, in which case errors that happen while following are passed to it and searching
+// is retried.
+func (tail *Tail) run(follow bool, initialEntries int, onError func(err error)) error {
+	_, err := tail.fetch(follow, initialEntries)
+	if err != nil {
+		if !follow || onError == nil {
+			return err
+		}
+		onError(err)
+	}
 	delay := 500 * time.Millisecond
+	lastCheckpoint := time.Now()
 	for follow {
-		time.Sleep(delay)
-		if tail.lastTimeStamp != "" {
-			//we can execute follow up timestamp filtered query only if we fetched at least 1 result in initial query
-			result, err = tail.client.Search().
-				Index(tail.indices...).
-				Sort(tail.queryDefinition.TimestampField, false).
-				From(0).
-				Size(9000). //TODO: needs rewrite this using scrolling, as this implementation may loose entries if there's more than 9K entries per sleep period
-				Query(tail.buildTimestampFilteredQuery()).
-				Do(context.Background())
-		} else {
-			//if lastTimeStamp is not defined we have to repeat the initial search until we get at least 1 result
-			result, err = tail.initialSearch(initialEntries)
+		if !tail.wait(delay) {
+			return nil
 		}
+		var fetched int
+		//if lastTimeStamp is not defined we have to repeat the initial search until we get at least 1 result
+		fetched, err = tail.fetch(follow, initialEntries)
 		if err != nil {
-			Error.Fatalln("Error in executing search query.", err)
+			if onError == nil {
+				return err
+			}
+			onError(err)
+			if !tail.wait(retryDelay) {
+				return nil
+			}
+			continue
 		}
-		tail.processResults(result)
 
 		//Dynamic delay calculation for determining delay between search requests
-		if result.TotalHits() > 0 && delay > 500*time.Millisecond {
+		if fetched > 0 && delay > 500*time.Millisecond {
 			delay = 500 * time.Millisecond
 		} else if delay <= 2000*time.Millisecond {
 			delay = delay + 500*time.Millisecond
 		}
+
+		if time.Since(lastCheckpoint) > checkpointInterval {
+			tail.saveCheckpoint()
+			lastCheckpoint = time.Now()
+		}
+	}
+	return nil
+}
+
+// Waits for the given duration before the next search. Returns false if the tail was stopped in the meantime.
+func (tail *Tail) wait(delay time.Duration) bool {
+	select {
+	case <-tail.stop:
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// Returns whether the tail was stopped
+func (tail *Tail) stopped() bool {
+	select {
+	case <-tail.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Kinds of searches the tail runs, see nextSearch
+type searchKind int
+
+const (
+	searchFollowUp    searchKind = iota //timestamp filtered follow up query (also used when resuming from checkpoint)
+	searchListSince                     //all of the entries since the date-after date, before switching to tailing
+	searchExport                        //all of the entries or large number of them, paged
+	searchInitialLast                   //last N entries (or first N if date-after filtering) using a single query
+)
+
+// Decides which search the tail runs next. Used by run as well as by --dry-run and --explain, so that they describe
+// the search that is actually going to run.
+func (tail *Tail) nextSearch(follow bool, initialEntries int) searchKind {
+	switch {
+	case tail.following():
+		//we can execute follow up timestamp filtered query only if we fetched at least 1 result in initial query,
+		//listed all of the entries since the date-after date or resumed from checkpoint
+		return searchFollowUp
+	case follow && tail.order:
+		return searchListSince
+	case !follow && (initialEntries <= 0 || initialEntries > exportPageSize):
+		//listing large number of entries, stream them page by page instead of fetching them with a single query
+		return searchExport
+	}
+	return searchInitialLast
+}
+
+// Runs the next search (see nextSearch) and processes its results. Returns the number of fetched entries.
+func (tail *Tail) fetch(follow bool, initialEntries int) (int, error) {
+	switch tail.nextSearch(follow, initialEntries) {
+	case searchFollowUp:
+		return tail.followSearch()
+	case searchListSince:
+		fetched, err := tail.export(0)
+		if err == nil {
+			//the search query is bounded by the date-after date, so follow up queries can continue from it
+			tail.listedSince = true
+		}
+		return fetched, err
+	case searchExport:
+		return tail.export(initialEntries)
+	}
+	return tail.initialFetch(initialEntries)
+}
+
+// Fetches and processes the initial entries - the last N entries, or, when date-after filtering, the first N
+// entries since the date. Returns the number of fetched entries.
+func (tail *Tail) initialFetch(initialEntries int) (int, error) {
+	result, err := tail.initialSearch(initialEntries)
+	if err != nil {
+		return 0, err
+	}
+	tail.processResults(result, tail.order)
+	return len(result.Hits.Hits), nil
+}
+
+// Returns whether the initial entries were fetched, so that the follow up queries can be executed
+func (tail *Tail) following() bool {
+	return tail.lastTimeStamp != "" || tail.listedSince
+}
+
+// Executes timestamp filtered follow up query and pages through all of its results in ascending order using
+// search_after, so that no entries are lost no matter how many of them arrived since the previous query.
+// Returns the number of fetched entries.
+func (tail *Tail) followSearch() (int, error) {
+	//query is built only once so that all the pages are fetched using the same timestamp and ID filter
+	query := tail.buildTimestampFilteredQuery()
+	var searchAfter []interface{}
+	fetched := 0
+	for {
+		result, err := tail.searchPage(nil, query, true, searchAfter, followPageSize, true)
+		if err != nil {
+			return fetched, err
+		}
+		tail.processResults(result, true)
+		hits := result.Hits.Hits
+		fetched += len(hits)
+		if len(hits) < followPageSize {
+			return fetched, nil
+		}
+		searchAfter = hits[len(hits)-1].Sort
+	}
+}
+
+// Streams the given number of entries (or all of the matching entries if entries is not positive) page by page
+// using search_after, so that memory usage stays constant regardless of the number of entries listed. Entries are
+// always printed in ascending order. When listing in descending order (e.g. the last N entries) we first need to
+// find the entry after which to start listing. All pages are fetched within a point in time (or scroll on clusters
+// that don't support it), so that entries written while exporting are neither skipped nor repeated. Returns the
+// number of listed entries.
+func (tail *Tail) export(entries int) (int, error) {
+	query := tail.buildSearchQuery()
+	pit, err := tail.openPointInTime()
+	if err != nil {
+		Trace.Printf("Could not open point in time, exporting using scroll: %s\n", err)
+		return tail.scrollExport(query, entries)
+	}
+	fetched, err := tail.pointInTimeExport(pit, query, entries)
+	tail.closePointInTime(pit)
+	if err != nil && fetched == 0 {
+		Trace.Printf("Could not search within point in time, exporting using scroll: %s\n", err)
+		return tail.scrollExport(query, entries)
+	}
+	return fetched, err
+}
+
+// Exports entries (see export) within the point in time
+func (tail *Tail) pointInTimeExport(pit *pointInTime, query elastic.Query, entries int) (int, error) {
+	var searchAfter []interface{}
+	var err error
+	if !tail.order && entries > 0 {
+		searchAfter, err = tail.findExportStart(pit, query, entries)
+		if err != nil {
+			return 0, err
+		}
+	}
+	fetched := 0
+	remaining := entries
+	for entries <= 0 || remaining > 0 {
+		size := exportPageSize
+		if entries > 0 && remaining < size {
+			size = remaining
+		}
+		result, err := tail.searchPage(pit, query, true, searchAfter, size, true)
+		if err != nil {
+			return fetched, err
+		}
+		tail.processResults(result, true)
+		hits := result.Hits.Hits
+		fetched += len(hits)
+		remaining -= len(hits)
+		if len(hits) < size {
+			break
+		}
+		searchAfter = hits[len(hits)-1].Sort
+	}
+	return fetched, nil
+}
+
+// Pages through the query results in descending order (without fetching the sources) in order to find sort values
+// of the entry that precedes the last N entries. Returns nil if there are N or less matching entries in total.
+func (tail *Tail) findExportStart(pit *pointInTime, query elastic.Query, entries int) ([]interface{}, error) {
+	var searchAfter []interface{}
+	remaining := entries + 1
+	for remaining > 0 {
+		size := exportPageSize
+		if remaining < size {
+			size = remaining
+		}
+		result, err := tail.searchPage(pit, query, false, searchAfter, size, false)
+		if err != nil {
+			return nil, err
+		}
+		hits := result.Hits.Hits
+		remaining -= len(hits)
+		if len(hits) < size {
+			return nil, nil
+		}
+		searchAfter = hits[len(hits)-1].Sort
+	}
+	return searchAfter, nil
+}
+
+// Fetches a single page of query results sorted by timestamp (and tiebreaker field) starting after the given sort
+// values. If searchAfter is nil, first page is fetched. If point in time is given, the page is fetched within it.
+func (tail *Tail) searchPage(pit *pointInTime, query elastic.Query, ascending bool, searchAfter []interface{},
+	size int, fetchSource bool) (*elastic.SearchResult, error) {
+	source := elastic.NewSearchSource().
+		SortBy(tail.pagingSorters(ascending, pit != nil)...).
+		Size(size).
+		FetchSource(fetchSource).
+		Query(query)
+	if searchAfter != nil {
+		source = source.SearchAfter(searchAfter...)
+	}
+	if fetchSource {
+		if highlight := tail.highlighter.SearchHighlight(); highlight != nil {
+			source = source.Highlight(highlight)
+		}
+	}
+	if pit != nil {
+		return tail.searchPointInTime(pit, source)
+	}
+	return tail.search().SearchSource(source).Do(context.Background())
+}
+
+// Sort used for search_after paging - timestamp with a tiebreaker so that sort values are unique. Within a point in
+// time, elasticsearch (7.12+) adds the _shard_doc tiebreaker itself, since _uid is not sortable on clusters
+// supporting point in time.
+func (tail *Tail) pagingSorters(ascending bool, pointInTime bool) []elastic.Sorter {
+	timeStampSort := elastic.NewFieldSort(tail.queryDefinition.TimestampField).Order(ascending)
+	if pointInTime {
+		return []elastic.Sorter{timeStampSort}
 	}
+	return []elastic.Sorter{timeStampSort, elastic.NewFieldSort(tiebreakerField).Order(ascending)}
 }
 
 // Initial search needs to be run until we get at least one result
 // in order to fetch the timestamp which we will use in subsequent follow searches
 func (tail *Tail) initialSearch(initialEntries int) (*elastic.SearchResult, error) {
-	return tail.client.Search().
-		Index(tail.indices...).
+	search := tail.search().
 		Sort(tail.queryDefinition.TimestampField, tail.order).
 		Query(tail.buildSearchQuery()).
-		From(0).Size(initialEntries).
-		Do(context.Background())
+		From(0).Size(initialEntries)
+	return tail.withHighlight(search).Do(context.Background())
+}
+
+// Returns search service targeting the selected indices
+func (tail *Tail) search() *elastic.SearchService {
+	search := tail.client.Search().Index(tail.indices...)
+	if tail.lenientIndices {
+		search = search.IgnoreUnavailable(true).AllowNoIndices(true)
+	}
+	return search
 }
 
-// Process the results (e.g. prints them out based on configured format)
-func (tail *Tail) processResults(searchResult *elastic.SearchResult) {
+// Requests highlighting of query matches if it's enabled
+func (tail *Tail) withHighlight(search *elastic.SearchService) *elastic.SearchService {
+	if highlight := tail.highlighter.SearchHighlight(); highlight != nil {
+		return search.Highlight(highlight)
+	}
+	return search
+}
+
+// Process the results (e.g. prints them out based on configured format). Ascending tells whether the results
+// are sorted by timestamp in ascending or descending order.
+func (tail *Tail) processResults(searchResult *elastic.SearchResult, ascending bool) {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+	if tail.stopped() {
+		//the results are neither printed nor tracked, so that they are not skipped when resuming
+		return
+	}
 	Trace.Printf("Fetched page of %d results out of %d total.\n", len(searchResult.Hits.Hits), searchResult.Hits.TotalHits)
 	hits := searchResult.Hits.Hits
 
@@ -201,7 +594,7 @@ func (tail *Tail) processResults(searchResult *elastic.SearchResult) {
 	// equal to last timestamp minus tailing time window. Since we are tracking IDs of entries form previous query,
 	// we can use the IDs to remove the duplicates. https://github.com/knes1/elktail/issues/11
 
-	if tail.order {
+	if ascending {
 		for i := 0; i < len(hits); i++ {
 			hit := hits[i]
 			entry := tail.processHit(hit)
@@ -253,40 +646,47 @@ func (tail *Tail) processHit(hit *elastic.SearchHit) map[string]interface{} {
 	if err != nil {
 		Error.Fatalln("Failed parsing ElasticSearch response.", err)
 	}
-	tail.printResult(entry)
+	tail.printResult(tail.highlighter.Entry(entry, hit.Highlight))
 	return entry
 }
 
 // Print result according to format
 func (tail *Tail) printResult(entry map[string]interface{}) {
 	Trace.Println("Result: ", entry)
-	fields := formatRegexp.FindAllString(tail.queryDefinition.Format, -1)
-	Trace.Println("Fields: ", fields)
-	result := tail.queryDefinition.Format
-	for _, f := range fields {
-		value, _ := EvaluateExpression(entry, f[1:])
-		result = strings.Replace(result, f, value, -1)
+	if tail.output != nil {
+		tail.output(entry)
+		return
 	}
-	fmt.Println(result)
+	if tail.writer != nil {
+		tail.writer.Write(tail.formatLine(entry))
+		return
+	}
+	fmt.Println(tail.formatLine(entry))
+}
+
+// Formats the entry as a line of output
+func (tail *Tail) formatLine(entry map[string]interface{}) string {
+	return tail.highlighter.Line(tail.formatter.Format(entry))
 }
 
 func (tail *Tail) buildSearchQuery() elastic.Query {
-	var query elastic.Query
-	if len(tail.queryDefinition.Terms) > 0 {
-		result := strings.Join(tail.queryDefinition.Terms, " ")
-		Trace.Printf("Running query string query: %s", result)
-		query = elastic.NewQueryStringQuery(result)
-	} else {
-		Trace.Print("Running query match all query.")
-		query = elastic.NewMatchAllQuery()
+	query := tail.query
+	if len(tail.fieldFilters) == 0 && !tail.queryDefinition.IsDateTimeFiltered() {
+		return query
+	}
+	boolQuery := elastic.NewBoolQuery().Filter(query)
+	for _, filter := range tail.fieldFilters {
+		if filter.Negated {
+			boolQuery.MustNot(filter.Query)
+		} else {
+			boolQuery.Filter(filter.Query)
+		}
 	}
-
 	if tail.queryDefinition.IsDateTimeFiltered() {
 		// we have date filtering turned on, apply filter
-		filter := tail.buildDateTimeRangeQuery()
-		query = elastic.NewBoolQuery().Filter(query, filter)
+		boolQuery.Filter(tail.buildDateTimeRangeQuery())
 	}
-	return query
+	return boolQuery
 }
 
 //Builds range filter on timestamp field. You should only call this if start or end date times are defined
@@ -307,6 +707,10 @@ func (tail *Tail) buildDateTimeRangeQuery() *elastic.RangeQuery {
 }
 
 func (tail *Tail) buildTimestampFilteredQuery() elastic.Query {
+	if tail.lastTimeStamp == "" {
+		//nothing was listed since the date-after date yet, which already bounds the search query
+		return tail.buildSearchQuery()
+	}
 	timeStamp := formatElasticTimeStamp(parseElasticTimeStamp(tail.lastTimeStamp).Add(-tailingTimeWindow * time.Millisecond))
 
 	timeStampFilter := elastic.NewRangeQuery(tail.queryDefinition.TimestampField).
@@ -325,48 +729,94 @@ func (tail *Tail) buildTimestampFilteredQuery() elastic.Query {
 // Extracts and parses YMD date (year followed by month followed by day) from a given string. YMD values are separated by
 // separator character given as argument.
 func extractYMDDate(dateStr, separator string) time.Time {
+	parsed, err := findYMDDate(dateStr, separator)
+	if err != nil {
+		Error.Fatalln(err)
+	}
+	return parsed
+}
+
+// Same as extractYMDDate, but returns error instead of exiting if the date can't be extracted
+func findYMDDate(dateStr, separator string) (time.Time, error) {
 	dateRegexp := regexp.MustCompile(fmt.Sprintf(`(\d{4}%s\d{2}%s\d{2})`, separator, separator))
 	match := dateRegexp.FindAllStringSubmatch(dateStr, -1)
 	if len(match) == 0 {
-		Error.Fatalf("Failed to extract date: %s\n", dateStr)
+		return time.Time{}, fmt.Errorf("Failed to extract date: %s", dateStr)
 	}
 	result := match[0]
 	parsed, err := time.Parse(fmt.Sprintf("2006%s01%s02", separator, separator), result[0])
 	if err != nil {
-		Error.Fatalf("Failed parsing date: %s", err)
+		return time.Time{}, fmt.Errorf("Failed parsing date: %s", err)
 	}
-	return parsed
+	return parsed, nil
 }
 
-func findIndicesForDateRange(indices []string, indexPattern string, startDate string, endDate string) []string {
-	start := extractYMDDate(startDate, "-")
-	end := extractYMDDate(endDate, "-")
+// Parses date-time given as elasticsearch timestamp or date (YYYY-MM-DD)
+func parseRangeDate(date string) (time.Time, error) {
+	if parsed := parseElasticTimeStamp(date); !parsed.IsZero() {
+		return parsed, nil
+	}
+	return findYMDDate(date, "-")
+}
+
+// Returns error for the index whose name doesn't match the index date format
+func indexDateError(err error) error {
+	return fmt.Errorf("%s (use --index-date-format matching the index names, or --index-strategy rollover "+
+		"or alias for indices without dates in their names)", err)
+}
+
+// Returns indices matching the pattern whose periods (as determined from the dates in their names) overlap the
+// range between start and end date. Indices whose period only partially overlaps the range are included too.
+// Returns error if the dates can't be parsed or if one of the matching indices has no date in its name.
+func findIndicesForDateRange(indices []string, indexPattern string, dateFormat *IndexDateFormat, startDate string,
+	endDate string) ([]string, error) {
+	patterns, err := ParseIndexPatterns(indexPattern)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseRangeDate(startDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseRangeDate(endDate)
+	if err != nil {
+		return nil, err
+	}
 	result := make([]string, 0, len(indices))
 	for _, idx := range indices {
-		matched, _ := regexp.MatchString(indexPattern, idx)
-		if matched {
-			idxDate := extractYMDDate(idx, ".")
-			if (idxDate.After(start) || idxDate.Equal(start)) && (idxDate.Before(end) || idxDate.Equal(end)) {
+		if patterns.Matches(idx) {
+			periodStart, periodEnd, err := dateFormat.Period(idx)
+			if err != nil {
+				return nil, indexDateError(err)
+			}
+			if !periodStart.After(end) && periodEnd.After(start) {
 				result = append(result, idx)
 			}
 		}
 	}
-	return result
+	return result, nil
 }
 
-func findLastIndex(indices []string, indexPattern string) string {
-	var lastIdx string
-	for _, idx := range indices {
-		matched, _ := regexp.MatchString(indexPattern, idx)
-		if matched {
-			if &lastIdx == nil {
-				lastIdx = idx
-			} else if idx > lastIdx {
+// Returns the last index (by name) matched by each of the included index patterns. Returns error if the index
+// patterns are not valid.
+func findLastIndices(indices []string, indexPattern string) ([]string, error) {
+	patterns, err := ParseIndexPatterns(indexPattern)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(patterns.Include))
+	for i := range patterns.Include {
+		var lastIdx string
+		for _, idx := range indices {
+			if patterns.MatchesInclude(i, idx) && idx > lastIdx {
 				lastIdx = idx
 			}
 		}
+		if lastIdx != "" && !containsString(result, lastIdx) {
+			result = append(result, lastIdx)
+		}
 	}
-	return lastIdx
+	return result, nil
 }
 
 func main() {
@@ -379,12 +829,19 @@ func main() {
 	app.Version = VERSION
 	app.ArgsUsage = "[query-string]\n   Options marked with (*) are saved between invocations of the command. Each time you specify an option marked with (*) previously stored settings are erased."
 	app.Flags = config.Flags()
-	app.Action = func(c *cli.Context) {
-
-		if c.IsSet("help") {
-			cli.ShowAppHelp(c)
-			os.Exit(0)
-		}
+	app.Commands = []cli.Command{
+		profileCommand(),
+		configCommand(config),
+		sqlCommand(config),
+		countCommand(config),
+		histogramCommand(config),
+		topCommand(config),
+		fieldsCommand(config),
+		indicesCommand(config),
+		completionCommand(),
+	}
+	app.EnableBashCompletion = true
+	app.Before = func(c *cli.Context) error {
 		if config.MoreVerbose || config.TraceRequests {
 			InitLogging(os.Stderr, os.Stderr, os.Stderr, true)
 		} else if config.Verbose {
@@ -392,83 +849,49 @@ func main() {
 		} else {
 			InitLogging(ioutil.Discard, ioutil.Discard, os.Stderr, false)
 		}
-		if !IsConfigRelevantFlagSet(c) {
-			loadedConfig, err := LoadDefault()
-			if err != nil {
-				Info.Printf("Failed to find or open previous default configuration: %s\n", err)
-			} else {
-				Info.Printf("Loaded previous config and connecting to host %s.\n", loadedConfig.SearchTarget.Url)
-				loadedConfig.CopyConfigRelevantSettingsTo(config)
-
-				if config.MoreVerbose {
-					confJs, _ := json.MarshalIndent(loadedConfig, "", "  ")
-					Trace.Println("Loaded config:")
-					Trace.Println(string(confJs))
-
-					confJs, _ = json.MarshalIndent(loadedConfig, "", "  ")
-					Trace.Println("Final (merged) config:")
-					Trace.Println(string(confJs))
-				}
-			}
-		}
+		return nil
+	}
+	app.Action = func(c *cli.Context) {
 
-		if config.User != "" {
-			fmt.Print("Enter password: ")
-			config.Password = readPasswd()
+		if c.IsSet("help") {
+			cli.ShowAppHelp(c)
+			os.Exit(0)
 		}
+		configToSave := prepareConfiguration(config, mainFlags(c), c.Args())
 
-		//reset TunnelUrl to nothing, we'll point to the tunnel if we actually manage to create it
-		config.SearchTarget.TunnelUrl = ""
-		if config.SSHTunnelParams != "" {
-			//We need to start ssh tunnel and make el client connect to local port at localhost in order to pass
-			//traffic through the tunnel
-			elurl, err := url.Parse(config.SearchTarget.Url)
-			if err != nil {
-				Error.Fatalf("Failed to parse hostname/port from given URL: %s\n", config.SearchTarget.Url)
+		if len(config.Clusters) > 0 {
+			if config.DryRun || config.Explain {
+				Error.Fatalln("Dry run and explain can not be combined with tailing several clusters.")
 			}
-			Trace.Printf("SSHTunnel remote host: %s\n", elurl.Host)
-
-			tunnel := NewSSHTunnelFromHostStrings(config.SSHTunnelParams, elurl.Host)
-			//Using the TunnelUrl configuration param, we will signify the client to connect to tunnel
-			config.SearchTarget.TunnelUrl = fmt.Sprintf("http://localhost:%d", tunnel.Local.Port)
-
-			Info.Printf("Starting SSH tunnel %d:%s@%s:%d to %s:%d", tunnel.Local.Port, tunnel.Config.User,
-				tunnel.Server.Host, tunnel.Server.Port, tunnel.Remote.Host, tunnel.Remote.Port)
-			go tunnel.Start()
-			Trace.Print("Sleeping for a second until tunnel is established...")
-			time.Sleep(1 * time.Second)
+			clusters := ConnectClusters(config)
+			if err := configToSave.SaveProfile(config.Profile); err != nil {
+				Error.Println(err)
+			}
+			TailClusters(clusters, config, !config.IsListOnly(), config.InitialEntries)
+			return
 		}
 
-		var configToSave *Configuration
-
-		args := c.Args()
-
-		if config.SaveQuery {
-			if args.Present() {
-				config.QueryDefinition.Terms = []string{args.First()}
-				config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, args.Tail()...)
-			} else {
-				config.QueryDefinition.Terms = []string{}
+		tail := NewTail(config)
+		if config.DryRun || config.Explain {
+			out := os.Stdout
+			if !config.DryRun {
+				//the tail is started after explaining, so keep the stdout for the entries
+				out = os.Stderr
 			}
-			configToSave = config.Copy()
-			Trace.Printf("Saving query terms. Total terms: %d\n", len(configToSave.QueryDefinition.Terms))
-		} else {
-			Trace.Printf("Not saving query terms. Total terms: %d\n", len(config.QueryDefinition.Terms))
-			configToSave = config.Copy()
-			if args.Present() {
-				if len(config.QueryDefinition.Terms) > 1 {
-					config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, "AND")
-					config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, args...)
-				} else {
-					config.QueryDefinition.Terms = []string{args.First()}
-					config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, args.Tail()...)
+			tail.DryRun(out, !config.IsListOnly(), config.InitialEntries)
+			if config.Explain {
+				if err := tail.Explain(out, !config.IsListOnly(), config.InitialEntries); err != nil {
+					Error.Fatalln(err)
 				}
 			}
+			if config.DryRun {
+				return
+			}
 		}
-
-		tail := NewTail(config)
 		//If we don't exit here we can save the defaults
-		configToSave.SaveDefault()
+		if err := configToSave.SaveProfile(config.Profile); err != nil {
+			Error.Println(err)
+		}
 
 		tail.Start(!config.IsListOnly(), config.InitialEntries)
 	}
@@ -486,6 +909,158 @@ func Must(result bool, err error) bool {
 	return result
 }
 
+// Accessors of the application's flags. Commands access them as global flags, while the main action accesses
+// them directly.
+type flagAccessors struct {
+	isSet       func(name string) bool
+	boolValue   func(name string) bool
+	stringSlice func(name string) []string
+}
+
+func mainFlags(c *cli.Context) flagAccessors {
+	return flagAccessors{isSet: c.IsSet, boolValue: c.Bool, stringSlice: c.StringSlice}
+}
+
+func globalFlags(c *cli.Context) flagAccessors {
+	return flagAccessors{isSet: c.GlobalIsSet, boolValue: c.GlobalBool, stringSlice: c.GlobalStringSlice}
+}
+
+// Prepares the configuration for searching - loads the saved profile, combines saved query terms and filters with
+// the given ones (args are query terms), applies configuration layers, connects (starting SSH tunnel if needed) and
+// resolves date filters. Returns the configuration that is to be saved to the profile.
+func prepareConfiguration(config *Configuration, flags flagAccessors, args cli.Args) *Configuration {
+	config.QueryDefinition.ColorRules = flags.stringSlice("color-rule")
+	config.Clusters = flags.stringSlice("cluster")
+	//filters given on the command line, saved ones are loaded with the profile below
+	filters, exists := flags.stringSlice("F"), flags.stringSlice("exists")
+	if config.Profile == "" {
+		config.Profile = LoadDefaultProfileName()
+	} else if err := validateProfileName(config.Profile); err != nil {
+		Error.Fatalln(err)
+	}
+	//layers need to be loaded before saved profile is merged into config, while it still holds flag values only
+	configLayers := LoadConfigLayers(config, flags.isSet)
+	if !IsConfigRelevantFlagSet(flags.isSet) {
+		loadedConfig, err := LoadProfile(config.Profile)
+		if err != nil {
+			Info.Printf("Failed to find or open configuration profile %s: %s\n", config.Profile, err)
+		} else {
+			Info.Printf("Loaded profile %s and connecting to host %s.\n", config.Profile, loadedConfig.SearchTarget.Url)
+			loadedConfig.CopyConfigRelevantSettingsTo(config)
+
+			if config.MoreVerbose {
+				confJs, _ := json.MarshalIndent(loadedConfig, "", "  ")
+				Trace.Println("Loaded config:")
+				Trace.Println(string(confJs))
+
+				confJs, _ = json.MarshalIndent(loadedConfig, "", "  ")
+				Trace.Println("Final (merged) config:")
+				Trace.Println(string(confJs))
+			}
+		}
+	}
+
+	var configToSave *Configuration
+
+	if config.SaveQuery {
+		if args.Present() {
+			config.QueryDefinition.Terms = []string{args.First()}
+			config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, args.Tail()...)
+		} else {
+			config.QueryDefinition.Terms = []string{}
+		}
+		config.QueryDefinition.Filters = filters
+		config.QueryDefinition.Exists = exists
+		configToSave = config.Copy()
+		if flags.boolValue("kql") {
+			//saved terms are KQL, so the profile needs to remember the language as well
+			configToSave.QueryDefinition.QueryLanguage = queryLanguageKQL
+		}
+		Trace.Printf("Saving query terms. Total terms: %d\n", len(configToSave.QueryDefinition.Terms))
+	} else {
+		Trace.Printf("Not saving query terms. Total terms: %d\n", len(config.QueryDefinition.Terms))
+		configToSave = config.Copy()
+		if args.Present() {
+			if len(config.QueryDefinition.Terms) > 1 {
+				config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, "AND")
+				config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, args...)
+			} else {
+				config.QueryDefinition.Terms = []string{args.First()}
+				config.QueryDefinition.Terms = append(config.QueryDefinition.Terms, args.Tail()...)
+			}
+		}
+		config.QueryDefinition.Filters = append(config.QueryDefinition.Filters, filters...)
+		config.QueryDefinition.Exists = append(config.QueryDefinition.Exists, exists...)
+	}
+
+	//environment variables and project file take precedence over saved profile, but are not saved to it
+	config.ApplyLayers(configLayers)
+	if flags.boolValue("kql") {
+		config.QueryDefinition.QueryLanguage = queryLanguageKQL
+	}
+
+	//clusters connect using users from their own profiles, which are checked when connecting to them
+	if len(config.Clusters) == 0 && config.User != "" && config.QueryDefinition.QueryDSL == queryDSLStdin {
+		Error.Fatalln("Query DSL can not be read from standard input when password needs to be entered.")
+	}
+	if err := config.QueryDefinition.LoadQueryDSLBody(os.Stdin); err != nil {
+		Error.Fatalln(err)
+	}
+	if _, err := ParseIndexDateFormat(config.SearchTarget.IndexDateFormat); err != nil {
+		Error.Fatalln("Invalid index date format.", err)
+	}
+	//aliases and wildcard expressions are resolved by elasticsearch instead of being matched as patterns
+	strategy := config.SearchTarget.IndexStrategy
+	if strategy != indexStrategyAlias && strategy != indexStrategyWildcard {
+		if _, err := ParseIndexPatterns(config.SearchTarget.IndexPattern); err != nil {
+			Error.Fatalln("Invalid index pattern.", err)
+		}
+	}
+	if len(config.Clusters) == 0 {
+		//when tailing several clusters, each one connects using the settings from its own profile
+		prepareConnection(config)
+	}
+
+	if config.Follow && (config.ListOnly || config.QueryDefinition.BeforeDateTime != "") {
+		Error.Fatalln("Following can not be combined with list-only mode or date-before filter.")
+	}
+	if err := config.QueryDefinition.ResolveDateTimes(time.Now()); err != nil {
+		Error.Fatalf("Invalid date-time filter: %s\n", err)
+	}
+	return configToSave
+}
+
+// Prepares the connection to elasticsearch - prompts for password if user is set and starts SSH tunnel if
+// tunnel parameters are set
+func prepareConnection(config *Configuration) {
+	if config.User != "" {
+		fmt.Print("Enter password: ")
+		config.Password = readPasswd()
+	}
+
+	//reset TunnelUrl to nothing, we'll point to the tunnel if we actually manage to create it
+	config.SearchTarget.TunnelUrl = ""
+	if config.SSHTunnelParams != "" {
+		//We need to start ssh tunnel and make el client connect to local port at localhost in order to pass
+		//traffic through the tunnel
+		elurl, err := url.Parse(config.SearchTarget.Url)
+		if err != nil {
+			Error.Fatalf("Failed to parse hostname/port from given URL: %s\n", config.SearchTarget.Url)
+		}
+		Trace.Printf("SSHTunnel remote host: %s\n", elurl.Host)
+
+		tunnel := NewSSHTunnelFromHostStrings(config.SSHTunnelParams, elurl.Host)
+		//Using the TunnelUrl configuration param, we will signify the client to connect to tunnel
+		config.SearchTarget.TunnelUrl = fmt.Sprintf("http://localhost:%d", tunnel.Local.Port)
+
+		Info.Printf("Starting SSH tunnel %d:%s@%s:%d to %s:%d", tunnel.Local.Port, tunnel.Config.User,
+			tunnel.Server.Host, tunnel.Server.Port, tunnel.Remote.Host, tunnel.Remote.Port)
+		go tunnel.Start()
+		Trace.Print("Sleeping for a second until tunnel is established...")
+		time.Sleep(1 * time.Second)
+	}
+}
+
 // Read password from the console
 func readPasswd() string {
 	bytePassword, err := terminal.ReadPassword(0)
@@ -503,8 +1078,18 @@ func readPasswd() string {
 // If a key given in the expression does not exist in the model, function will return empty string and
 // an error.
 func EvaluateExpression(model interface{}, fieldExpression string) (string, error) {
+	value, err := EvaluateValue(model, fieldExpression)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// EvaluateValue evaluates expression in the same way as EvaluateExpression, but returns the value itself instead of
+// its string representation.
+func EvaluateValue(model interface{}, fieldExpression string) (interface{}, error) {
 	if fieldExpression == "" {
-		return fmt.Sprintf("%v", model), nil
+		return model, nil
 	}
 	parts := strings.SplitN(fieldExpression, ".", 2)
 	expression := parts[0]
@@ -515,14 +1100,14 @@ func EvaluateExpression(model interface{}, fieldExpression string) (string, erro
 		if value != nil {
 			nextModel = value
 		} else {
-			return "", fmt.Errorf("Failed to evaluate expression %s on given model (model map does not contain that key?).", fieldExpression)
+			return nil, fmt.Errorf("Failed to evaluate expression %s on given model (model map does not contain that key?).", fieldExpression)
 		}
 	} else {
-		return "", fmt.Errorf("Model on which %s is to be evaluated is not a map.", fieldExpression)
+		return nil, fmt.Errorf("Model on which %s is to be evaluated is not a map.", fieldExpression)
 	}
 	nextExpression := ""
 	if len(parts) > 1 {
 		nextExpression = parts[1]
 	}
-	return EvaluateExpression(nextModel, nextExpression)
+	return EvaluateValue(nextModel, nextExpression)
 }
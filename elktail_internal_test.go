@@ -6,8 +6,16 @@
 package main
 
 import (
+	"fmt"
 	tu "github.com/knes1/elktail/testutils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestExtractDate(t *testing.T) {
@@ -24,7 +32,11 @@ func TestFindIndicesForDateRange(t *testing.T) {
 		"logstash-2016.06.19",
 		"logstash-2016.06.20",
 	}
-	x := findIndicesForDateRange(indices[0:], "logstash.*", "2016-06-16", "2016-06-18")
+	dateFormat, _ := ParseIndexDateFormat("")
+	x, err := findIndicesForDateRange(indices[0:], "logstash.*", dateFormat, "2016-06-16", "2016-06-18")
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log(x)
 	tu.AssertEqualsInt(t, 3, len(x))
 
@@ -41,3 +53,92 @@ func TestDrainOldEntries(t *testing.T) {
 	tu.AssertEqualsInt(t, 2, len(arr))
 
 }
+
+func TestFollowAfterEmptyListing(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	searches := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "_pit"):
+			w.Write([]byte(`{"id": "pit-1"}`))
+		default:
+			searches = append(searches, r.URL.Path)
+			w.Write([]byte(`{"hits": {"total": 0, "hits": []}}`))
+		}
+	}))
+	defer server.Close()
+	var messages []string
+	tail := exportTail(t, server.URL, &messages)
+	tail.order = true
+
+	//nothing was written since the date-after date yet, following continues with follow up queries
+	fetched, err := tail.fetch(true, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 0, fetched)
+	if !tail.following() {
+		tu.Fail(t, "Expected following after listing the entries since the date-after date")
+	}
+	if _, err := tail.followSearch(); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "/_search,/logstash-2016.07.01,logstash-2016.07.02/_search", strings.Join(searches, ","))
+}
+
+// Returns search response with hits for the entries from first to last, sorted by timestamp and _uid
+func followHits(first int, last int) string {
+	base := time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC)
+	hits := make([]string, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		timeStamp := base.Add(time.Duration(i) * time.Second)
+		hits = append(hits, fmt.Sprintf(`{"_id": "%d", "sort": [%d, "log#%d"], `+
+			`"_source": {"@timestamp": "%s", "message": "%d"}}`, i, timeStamp.UnixNano()/1e6, i,
+			formatElasticTimeStamp(timeStamp), i))
+	}
+	return fmt.Sprintf(`{"hits": {"total": %d, "hits": [%s]}}`, len(hits), strings.Join(hits, ","))
+}
+
+func TestFollowSearchPaging(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	bodies := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.Write([]byte(followHits(1, followPageSize)))
+		} else {
+			w.Write([]byte(followHits(followPageSize+1, followPageSize+500)))
+		}
+	}))
+	defer server.Close()
+	var messages []string
+	tail := exportTail(t, server.URL, &messages)
+	tail.lastTimeStamp = "2016-07-01T12:00:00.000Z"
+
+	//full page is followed by the next one, starting after the last entry of the full page
+	fetched, err := tail.followSearch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, followPageSize+500, fetched)
+	tu.AssertEqualsInt(t, 2, len(bodies))
+	if strings.Contains(bodies[0], "search_after") {
+		tu.Fail(t, "Expected first page without search_after, got "+bodies[0])
+	}
+	lastTimeStamp := time.Date(2016, 7, 1, 12, 0, followPageSize, 0, time.UTC).UnixNano() / 1e6
+	searchAfter := fmt.Sprintf(`"search_after":[%d,"log#%d"]`, lastTimeStamp, followPageSize)
+	if !strings.Contains(bodies[1], searchAfter) {
+		tu.Fail(t, "Expected "+searchAfter+" in the second page request, got "+bodies[1])
+	}
+	tu.AssertEqualsInt(t, followPageSize+500, len(messages))
+	for i, message := range messages {
+		tu.AssertEqualsString(t, strconv.Itoa(i+1), message)
+	}
+}
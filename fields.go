@@ -0,0 +1,247 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Number of recent entries example values are taken from, maximum number of distinct values shown per field and
+// maximum length of the value
+const (
+	fieldSampleEntries  = 20
+	fieldSampleValues   = 3
+	fieldSampleMaxWidth = 40
+)
+
+// FieldInfo describes a field found in the index mappings
+type FieldInfo struct {
+	Path    string
+	Types   []string //types of the field in the mappings (more than one if indices map the field differently)
+	Samples []string //example values, filled only if sampling is requested
+}
+
+// Fields returns fields found in the mappings of the selected indices, sorted by path
+func (tail *Tail) Fields() ([]FieldInfo, error) {
+	getMapping := tail.client.GetMapping().Index(tail.indices...)
+	if tail.lenientIndices {
+		getMapping = getMapping.IgnoreUnavailable(true).AllowNoIndices(true)
+	}
+	mappings, err := getMapping.Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mappingFields(mappings), nil
+}
+
+// Extracts fields from the get mapping response, which is keyed by index name. Supports mappings with document
+// types (elasticsearch 6 and older) as well as typeless mappings.
+func mappingFields(mappings map[string]interface{}) []FieldInfo {
+	types := make(map[string][]string)
+	for _, indexMapping := range mappings {
+		index, _ := indexMapping.(map[string]interface{})
+		typeMappings, _ := index["mappings"].(map[string]interface{})
+		if _, typeless := typeMappings["properties"]; typeless {
+			collectMappingFields(typeMappings, "", types)
+			continue
+		}
+		for _, typeMapping := range typeMappings {
+			if mapping, ok := typeMapping.(map[string]interface{}); ok {
+				collectMappingFields(mapping, "", types)
+			}
+		}
+	}
+	fields := make([]FieldInfo, 0, len(types))
+	for fieldPath, fieldTypes := range types {
+		sort.Strings(fieldTypes)
+		fields = append(fields, FieldInfo{Path: fieldPath, Types: fieldTypes})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+	return fields
+}
+
+// Collects types of the fields defined in mapping's properties (and multi-fields) into types map, keyed by path
+func collectMappingFields(mapping map[string]interface{}, prefix string, types map[string][]string) {
+	properties, _ := mapping["properties"].(map[string]interface{})
+	for name, property := range properties {
+		definition, ok := property.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fieldPath := prefix + name
+		fieldType, _ := definition["type"].(string)
+		if fieldType == "" && definition["properties"] != nil {
+			fieldType = "object"
+		}
+		if fieldType != "object" {
+			addFieldType(types, fieldPath, fieldType)
+		}
+		collectMappingFields(definition, fieldPath+".", types)
+		multiFields, _ := definition["fields"].(map[string]interface{})
+		for subName, subField := range multiFields {
+			if subDefinition, ok := subField.(map[string]interface{}); ok {
+				subType, _ := subDefinition["type"].(string)
+				addFieldType(types, fieldPath+"."+subName, subType)
+			}
+		}
+	}
+}
+
+func addFieldType(types map[string][]string, fieldPath string, fieldType string) {
+	for _, existing := range types[fieldPath] {
+		if existing == fieldType {
+			return
+		}
+	}
+	types[fieldPath] = append(types[fieldPath], fieldType)
+}
+
+// Returns fields whose path matches the pattern and which have the given type (if not empty). Pattern containing
+// wildcards (* and ?) needs to match the whole path, otherwise path needs to contain the pattern (case insensitive).
+func filterFields(fields []FieldInfo, pattern string, fieldType string) []FieldInfo {
+	result := make([]FieldInfo, 0)
+	for _, field := range fields {
+		if pattern != "" {
+			if strings.ContainsAny(pattern, "*?[") {
+				if matched, _ := path.Match(pattern, field.Path); !matched {
+					continue
+				}
+			} else if !strings.Contains(strings.ToLower(field.Path), strings.ToLower(pattern)) {
+				continue
+			}
+		}
+		if fieldType != "" && !containsString(field.Types, fieldType) {
+			continue
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Fills in example values of the fields taken from the most recent entries matching the query
+func (tail *Tail) sampleFields(fields []FieldInfo) error {
+	result, err := tail.search().
+		Query(tail.buildSearchQuery()).
+		Sort(tail.queryDefinition.TimestampField, false).
+		Size(fieldSampleEntries).
+		Do(context.Background())
+	if err != nil {
+		return err
+	}
+	entries := make([]map[string]interface{}, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(*hit.Source, &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	for i := range fields {
+		fields[i].Samples = sampleValues(entries, fields[i].Path)
+	}
+	return nil
+}
+
+// Returns distinct values of the field in the entries (up to fieldSampleValues of them, truncated)
+func sampleValues(entries []map[string]interface{}, field string) []string {
+	samples := make([]string, 0, fieldSampleValues)
+	for _, entry := range entries {
+		value, err := EvaluateValue(entry, field)
+		if err != nil || value == nil {
+			continue
+		}
+		if _, isObject := value.(map[string]interface{}); isObject {
+			continue
+		}
+		sample := tsvEscaper.Replace(valueString(value))
+		if utf8.RuneCountInString(sample) > fieldSampleMaxWidth {
+			sample = string([]rune(sample)[:fieldSampleMaxWidth-3]) + "..."
+		}
+		if !containsString(samples, sample) {
+			samples = append(samples, sample)
+		}
+		if len(samples) == fieldSampleValues {
+			break
+		}
+	}
+	return samples
+}
+
+// Returns the fields command, which lists fields (with their types) found in the mappings of the selected indices
+func fieldsCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:      "fields",
+		Usage:     "List fields and their types from the mappings of the selected indices",
+		ArgsUsage: "[pattern]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "sample",
+				Usage: fmt.Sprintf("Show example values of the fields from the %d most recent entries", fieldSampleEntries),
+			},
+			cli.StringFlag{
+				Name:  "type",
+				Value: "",
+				Usage: "Only list the fields of the given type (example: --type date)",
+			},
+			cli.BoolFlag{
+				Name:  "names-only",
+				Usage: "Only print the field paths, one per line (used by shell completion)",
+			},
+		},
+		Action: func(c *cli.Context) {
+			prepareConfiguration(config, globalFlags(c), nil)
+			tail := NewTail(config)
+			fields, err := tail.Fields()
+			if err != nil {
+				Error.Fatalln("Failed to fetch index mappings.", err)
+			}
+			fields = filterFields(fields, c.Args().First(), c.String("type"))
+			if c.Bool("names-only") {
+				for _, field := range fields {
+					fmt.Println(field.Path)
+				}
+				return
+			}
+			if c.Bool("sample") {
+				if err := tail.sampleFields(fields); err != nil {
+					Error.Fatalln("Failed to fetch sample entries.", err)
+				}
+			}
+			writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			if c.Bool("sample") {
+				fmt.Fprintln(writer, "FIELD\tTYPE\tSAMPLE")
+			} else {
+				fmt.Fprintln(writer, "FIELD\tTYPE")
+			}
+			for _, field := range fields {
+				if c.Bool("sample") {
+					fmt.Fprintf(writer, "%s\t%s\t%s\n", field.Path, strings.Join(field.Types, ", "),
+						strings.Join(field.Samples, " | "))
+				} else {
+					fmt.Fprintf(writer, "%s\t%s\n", field.Path, strings.Join(field.Types, ", "))
+				}
+			}
+			writer.Flush()
+		},
+	}
+}
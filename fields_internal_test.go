@@ -0,0 +1,75 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"strings"
+	"testing"
+)
+
+func fieldsString(fields []FieldInfo) string {
+	lines := make([]string, 0, len(fields))
+	for _, field := range fields {
+		lines = append(lines, field.Path+" "+strings.Join(field.Types, ","))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestMappingFields(t *testing.T) {
+	var mappings map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"logstash-2016.01.01": {"mappings": {"logs": {"properties": {
+			"@timestamp": {"type": "date"},
+			"message": {"type": "text", "fields": {"keyword": {"type": "keyword"}}},
+			"request": {"properties": {"status": {"type": "long"}, "path": {"type": "keyword"}}}
+		}}}},
+		"logstash-2016.01.02": {"mappings": {"properties": {
+			"@timestamp": {"type": "date"},
+			"request": {"properties": {"status": {"type": "keyword"}}},
+			"spans": {"type": "nested", "properties": {"name": {"type": "keyword"}}}
+		}}}
+	}`), &mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, ""+
+		"@timestamp date\n"+
+		"message text\n"+
+		"message.keyword keyword\n"+
+		"request.path keyword\n"+
+		"request.status keyword,long\n"+
+		"spans nested\n"+
+		"spans.name keyword", fieldsString(mappingFields(mappings)))
+}
+
+func TestFilterFields(t *testing.T) {
+	fields := []FieldInfo{
+		{Path: "@timestamp", Types: []string{"date"}},
+		{Path: "Request.status", Types: []string{"long"}},
+		{Path: "request.time", Types: []string{"date"}},
+		{Path: "status", Types: []string{"keyword"}},
+	}
+	tu.AssertEqualsString(t, "Request.status long\nstatus keyword", fieldsString(filterFields(fields, "STATUS", "")))
+	tu.AssertEqualsString(t, "request.time date", fieldsString(filterFields(fields, "request.*", "")))
+	tu.AssertEqualsString(t, "@timestamp date\nrequest.time date", fieldsString(filterFields(fields, "", "date")))
+	tu.AssertEqualsString(t, "", fieldsString(filterFields(fields, "status", "date")))
+}
+
+func TestSampleValues(t *testing.T) {
+	entries := []map[string]interface{}{
+		{"host": "web-1", "request": map[string]interface{}{"status": 200.0}},
+		{"host": "web-1", "message": strings.Repeat("x", 50)},
+		{"host": "web-2"},
+		{"host": "web-3"},
+		{"host": "web-4"},
+	}
+	tu.AssertEqualsString(t, "web-1 | web-2 | web-3", strings.Join(sampleValues(entries, "host"), " | "))
+	tu.AssertEqualsString(t, "200", strings.Join(sampleValues(entries, "request.status"), " | "))
+	tu.AssertEqualsString(t, "", strings.Join(sampleValues(entries, "request"), " | "))
+	tu.AssertEqualsString(t, strings.Repeat("x", 37)+"...", strings.Join(sampleValues(entries, "message"), " | "))
+}
@@ -0,0 +1,83 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"strings"
+)
+
+// Operators supported in field filters. Two character operators need to be listed before their one character
+// prefixes.
+var filterOperators = []string{"!=", ">=", "<=", "=", "~", ">", "<"}
+
+// FieldFilter is a single clause of the bool query built from -F and --exists flags. Negated filters are added
+// to the must_not clause, others to the filter clause.
+type FieldFilter struct {
+	Query   elastic.Query
+	Negated bool
+}
+
+// ParseFieldFilter parses field filter given as field=value (term), field!=value (negated term), field~regex
+// (regexp), field>=n, field>n, field<=n or field<n (range). Filter is split at the first operator, so the value
+// may contain any characters without quoting.
+func ParseFieldFilter(filter string) (*FieldFilter, error) {
+	pos := strings.IndexAny(filter, "!=~<>")
+	if pos <= 0 {
+		return nil, fmt.Errorf("Invalid field filter %s (expected field=value, field!=value, field~regex, field>=n, field>n, field<=n or field<n).", filter)
+	}
+	field := filter[:pos]
+	for _, op := range filterOperators {
+		if !strings.HasPrefix(filter[pos:], op) {
+			continue
+		}
+		value := filter[pos+len(op):]
+		switch op {
+		case "=":
+			return &FieldFilter{Query: elastic.NewTermQuery(field, value)}, nil
+		case "!=":
+			return &FieldFilter{Query: elastic.NewTermQuery(field, value), Negated: true}, nil
+		case "~":
+			return &FieldFilter{Query: elastic.NewRegexpQuery(field, value)}, nil
+		}
+		if value == "" {
+			return nil, fmt.Errorf("Missing value in range filter %s.", filter)
+		}
+		query := elastic.NewRangeQuery(field)
+		switch op {
+		case ">=":
+			query.Gte(value)
+		case ">":
+			query.Gt(value)
+		case "<=":
+			query.Lte(value)
+		case "<":
+			query.Lt(value)
+		}
+		return &FieldFilter{Query: query}, nil
+	}
+	return nil, fmt.Errorf("Invalid operator in field filter %s.", filter)
+}
+
+// ParseFieldFilters parses all the field filters and exists filters of the query definition
+func (q *QueryDefinition) ParseFieldFilters() ([]FieldFilter, error) {
+	filters := make([]FieldFilter, 0, len(q.Filters)+len(q.Exists))
+	for _, filter := range q.Filters {
+		parsed, err := ParseFieldFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, *parsed)
+	}
+	for _, field := range q.Exists {
+		if field == "" {
+			return nil, fmt.Errorf("Missing field name in exists filter.")
+		}
+		filters = append(filters, FieldFilter{Query: elastic.NewExistsQuery(field)})
+	}
+	return filters, nil
+}
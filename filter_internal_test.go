@@ -0,0 +1,67 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"testing"
+)
+
+func querySource(t *testing.T, query elastic.Query) string {
+	source, err := query.Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := json.Marshal(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(result)
+}
+
+func TestParseFieldFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		query   string
+		negated bool
+	}{
+		{"kubernetes.pod.name=web-1", `{"term":{"kubernetes.pod.name":"web-1"}}`, false},
+		{"path=/api/v1/users?id=5", `{"term":{"path":"/api/v1/users?id=5"}}`, false},
+		{"level!=DEBUG", `{"term":{"level":"DEBUG"}}`, true},
+		{"message~time(out)?.*", `{"regexp":{"message":{"value":"time(out)?.*"}}}`, false},
+		{"status>=500", `{"range":{"status":{"from":"500","include_lower":true,"include_upper":true,"to":null}}}`, false},
+		{"status>499", `{"range":{"status":{"from":"499","include_lower":false,"include_upper":true,"to":null}}}`, false},
+		{"took<=10", `{"range":{"took":{"from":null,"include_lower":true,"include_upper":true,"to":"10"}}}`, false},
+		{"took<10", `{"range":{"took":{"from":null,"include_lower":true,"include_upper":false,"to":"10"}}}`, false},
+	}
+	for _, test := range tests {
+		filter, err := ParseFieldFilter(test.filter)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", test.filter, err)
+		}
+		tu.AssertEqualsString(t, test.query, querySource(t, filter.Query))
+		if filter.Negated != test.negated {
+			tu.Fail(t, "Unexpected negation for "+test.filter)
+		}
+	}
+	for _, invalid := range []string{"level", "=value", "level!value", "status>="} {
+		if _, err := ParseFieldFilter(invalid); err == nil {
+			tu.Fail(t, "Expected error for "+invalid)
+		}
+	}
+}
+
+func TestParseFieldFilters(t *testing.T) {
+	q := &QueryDefinition{Filters: []string{"level=ERROR"}, Exists: []string{"trace.id"}}
+	filters, err := q.ParseFieldFilters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 2, len(filters))
+	tu.AssertEqualsString(t, `{"exists":{"field":"trace.id"}}`, querySource(t, filters[1].Query))
+}
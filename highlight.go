@@ -0,0 +1,165 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"regexp"
+	"strings"
+)
+
+// Supported modes of highlighting query matches
+const (
+	highlightAuto   = "auto"
+	highlightAlways = "always"
+	highlightNever  = "never"
+)
+
+// Tags elasticsearch wraps the matched fragments with. They are replaced with highlight marks when printing.
+const (
+	highlightPreTag  = "\u0001"
+	highlightPostTag = "\u0002"
+)
+
+// Highlight marks - bold and inverse when colors are enabled (turned off without resetting the colors of the line)
+// or plain text markers otherwise
+var (
+	colorHighlightMarks = [2]string{"\x1b[1;7m", "\x1b[22;27m"}
+	plainHighlightMarks = [2]string{"**", "**"}
+)
+
+// Highlighter emphasizes parts of the output - query matches highlighted by elasticsearch and client side matches
+// of the given regular expression
+type Highlighter struct {
+	fields  []string       //fields for which elasticsearch highlighting is requested, nil if disabled
+	pattern *regexp.Regexp //client side highlight pattern, nil if not set
+	marks   [2]string
+}
+
+// NewHighlighter creates highlighter based on query definition. Query matches are highlighted (in fields referenced
+// in the format) when colors are enabled, or always if requested so. Highlighting is only done for format and
+// template output. Returns nil if there is nothing to highlight.
+func NewHighlighter(q *QueryDefinition) (*Highlighter, error) {
+	if q.Output != "" && q.Output != outputFormat {
+		return nil, nil
+	}
+	colors, err := colorEnabled(q.Color)
+	if err != nil {
+		return nil, err
+	}
+	highlighter := &Highlighter{marks: plainHighlightMarks}
+	if colors {
+		highlighter.marks = colorHighlightMarks
+	}
+	if q.Highlight != "" {
+		if highlighter.pattern, err = regexp.Compile(q.Highlight); err != nil {
+			return nil, fmt.Errorf("Invalid highlight pattern: %s", err)
+		}
+	}
+	switch q.HighlightMatches {
+	case "", highlightAuto:
+		if colors {
+			highlighter.fields = q.highlightFields()
+		}
+	case highlightAlways:
+		highlighter.fields = q.highlightFields()
+	case highlightNever:
+	default:
+		return nil, fmt.Errorf("Unknown highlight mode %s (supported modes are auto, always and never).", q.HighlightMatches)
+	}
+	if len(q.Terms) == 0 {
+		//no query to highlight
+		highlighter.fields = nil
+	}
+	if highlighter.fields == nil && highlighter.pattern == nil {
+		return nil, nil
+	}
+	return highlighter, nil
+}
+
+// Fields that are highlighted - fields referenced in the format (or all fields when using a template), except the
+// timestamp field (elasticsearch refuses to highlight non-text fields that are explicitly requested)
+func (q *QueryDefinition) highlightFields() []string {
+	if q.Template != "" && len(q.parseFields()) == 0 {
+		return []string{"*"}
+	}
+	fields := make([]string, 0)
+	for _, field := range q.OutputFields() {
+		if field != q.TimestampField {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// SearchHighlight returns highlight request for the search, nil if query matches are not highlighted
+func (h *Highlighter) SearchHighlight() *elastic.Highlight {
+	if h == nil || len(h.fields) == 0 {
+		return nil
+	}
+	fields := make([]*elastic.HighlighterField, len(h.fields))
+	for i, field := range h.fields {
+		fields[i] = elastic.NewHighlighterField(field)
+	}
+	//zero fragments means that the whole field value is returned, so it can replace the original value
+	return elastic.NewHighlight().
+		Fields(fields...).
+		PreTags(highlightPreTag).
+		PostTags(highlightPostTag).
+		NumOfFragments(0).
+		RequireFieldMatch(false)
+}
+
+// Entry returns copy of the entry in which values of highlighted fields are replaced with highlighted values
+func (h *Highlighter) Entry(entry map[string]interface{}, highlight elastic.SearchHitHighlight) map[string]interface{} {
+	if h == nil || len(highlight) == 0 {
+		return entry
+	}
+	result := entry
+	for field, fragments := range highlight {
+		if len(fragments) == 0 {
+			continue
+		}
+		value := strings.NewReplacer(highlightPreTag, h.marks[0], highlightPostTag, h.marks[1]).
+			Replace(strings.Join(fragments, " "))
+		result = withValue(result, field, value)
+	}
+	return result
+}
+
+// Line highlights matches of the client side highlight pattern in the formatted entry
+func (h *Highlighter) Line(line string) string {
+	if h == nil || h.pattern == nil {
+		return line
+	}
+	return h.pattern.ReplaceAllStringFunc(line, func(match string) string {
+		return h.marks[0] + match + h.marks[1]
+	})
+}
+
+// Returns copy of the model in which the value at dotted path is replaced with the given value. Only the maps along
+// the path are copied. Model is returned unchanged if the path does not exist.
+func withValue(model map[string]interface{}, path string, value interface{}) map[string]interface{} {
+	parts := strings.SplitN(path, ".", 2)
+	current, ok := model[parts[0]]
+	if !ok {
+		return model
+	}
+	if len(parts) > 1 {
+		nested, ok := current.(map[string]interface{})
+		if !ok {
+			return model
+		}
+		value = withValue(nested, parts[1], value)
+	}
+	result := make(map[string]interface{}, len(model))
+	for k, v := range model {
+		result[k] = v
+	}
+	result[parts[0]] = value
+	return result
+}
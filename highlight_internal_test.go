@@ -0,0 +1,82 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"regexp"
+	"testing"
+)
+
+func TestNewHighlighter(t *testing.T) {
+	q := &QueryDefinition{Format: "%@timestamp %level %message", TimestampField: "@timestamp", Color: "never",
+		Terms: []string{"error"}}
+	highlighter, err := NewHighlighter(q)
+	if err != nil || highlighter != nil {
+		t.Fatalf("Expected no highlighter without colors, got %v, %v", highlighter, err)
+	}
+	q.HighlightMatches = "always"
+	highlighter, err = NewHighlighter(q)
+	if err != nil || highlighter == nil {
+		t.Fatalf("Expected highlighter, got %v, %v", highlighter, err)
+	}
+	tu.AssertEqualsInt(t, 2, len(highlighter.fields))
+	tu.AssertEqualsString(t, "level", highlighter.fields[0])
+	tu.AssertEqualsString(t, "message", highlighter.fields[1])
+	if highlighter.SearchHighlight() == nil {
+		tu.Fail(t, "Expected search highlight")
+	}
+
+	q.Terms = nil
+	if highlighter, _ = NewHighlighter(q); highlighter != nil {
+		tu.Fail(t, "Expected no highlighter without query")
+	}
+	q.Highlight = "time(out)?"
+	if highlighter, _ = NewHighlighter(q); highlighter == nil || highlighter.SearchHighlight() != nil {
+		tu.Fail(t, "Expected client side only highlighter")
+	}
+	q.Output = outputJson
+	if highlighter, _ = NewHighlighter(q); highlighter != nil {
+		tu.Fail(t, "Expected no highlighter for json output")
+	}
+	if _, err = NewHighlighter(&QueryDefinition{Highlight: "("}); err == nil {
+		tu.Fail(t, "Expected error for invalid pattern")
+	}
+	if _, err = NewHighlighter(&QueryDefinition{HighlightMatches: "sometimes", Color: "never"}); err == nil {
+		tu.Fail(t, "Expected error for unknown mode")
+	}
+}
+
+func TestHighlighterEntry(t *testing.T) {
+	highlighter := &Highlighter{fields: []string{"*"}, marks: plainHighlightMarks}
+	entry := map[string]interface{}{
+		"message":    "request failed",
+		"kubernetes": map[string]interface{}{"pod": map[string]interface{}{"name": "web-1"}},
+	}
+	result := highlighter.Entry(entry, elastic.SearchHitHighlight{
+		"message":             {"request \u0001failed\u0002"},
+		"kubernetes.pod.name": {"\u0001web\u0002-1"},
+		"missing":             {"\u0001x\u0002"},
+	})
+	tu.AssertEqualsString(t, "request **failed**", result["message"].(string))
+	name, _ := EvaluateExpression(result, "kubernetes.pod.name")
+	tu.AssertEqualsString(t, "**web**-1", name)
+	if _, ok := result["missing"]; ok {
+		tu.Fail(t, "Expected missing field not to be added")
+	}
+	//original entry must be left intact
+	tu.AssertEqualsString(t, "request failed", entry["message"].(string))
+	name, _ = EvaluateExpression(entry, "kubernetes.pod.name")
+	tu.AssertEqualsString(t, "web-1", name)
+}
+
+func TestHighlighterLine(t *testing.T) {
+	highlighter := &Highlighter{pattern: regexp.MustCompile("time(out)?"), marks: colorHighlightMarks}
+	tu.AssertEqualsString(t, "read \x1b[1;7mtimeout\x1b[22;27m", highlighter.Line("read timeout"))
+	var disabled *Highlighter
+	tu.AssertEqualsString(t, "read timeout", disabled.Line("read timeout"))
+}
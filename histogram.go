@@ -0,0 +1,365 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/olivere/elastic.v5"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Name of the series holding the entries whose split field value is not among the top values
+const histogramOtherSeries = "other"
+
+// Characters used to fill the bars of the individual series in split histograms
+var histogramSeriesChars = []string{"█", "▓", "▒", "░", "#", "=", "+", ":"}
+
+// Characters used for partially filled bar (in eighths) and sparkline levels
+var (
+	histogramPartialChars = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+	sparklineChars        = []string{"▁", "▂", "▃", "▄", "▅", "▆", "▇", "█"}
+)
+
+// Histogram is the number of entries per time interval, optionally split into series by values of a field
+type Histogram struct {
+	Series  []string //top values of the split field, followed by "other" if there are other values; nil if not split
+	Buckets []HistogramBucket
+}
+
+// HistogramBucket is the number of entries in a single time interval
+type HistogramBucket struct {
+	Time   time.Time
+	Count  int64
+	Counts []int64 //counts per series, nil if not split
+}
+
+// Histogram runs date histogram aggregation over the timestamp field for the query, filters and date range. If
+// splitBy is set, entries are split by top values of the field.
+func (tail *Tail) Histogram(interval string, splitBy string, top int) (*Histogram, error) {
+	search := tail.search().
+		Query(tail.buildSearchQuery()).
+		Size(0).
+		Aggregation("histogram", tail.dateHistogramAggregation(interval))
+	if splitBy != "" {
+		search = search.Aggregation("split", elastic.NewTermsAggregation().
+			Field(splitBy).
+			Size(top).
+			SubAggregation("histogram", tail.dateHistogramAggregation(interval)))
+	}
+	result, err := search.Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return parseHistogram(result.Aggregations, splitBy != "")
+}
+
+// Date histogram over the timestamp field, with empty buckets for the whole date range (if given). Buckets are
+// aligned to the display time zone, so that e.g. daily buckets start at midnight.
+func (tail *Tail) dateHistogramAggregation(interval string) *elastic.DateHistogramAggregation {
+	aggregation := elastic.NewDateHistogramAggregation().
+		Field(tail.queryDefinition.TimestampField).
+		Interval(interval).
+		MinDocCount(0)
+	if tail.queryDefinition.TimeZone != "" && tail.queryDefinition.TimeZone != "Local" {
+		aggregation = aggregation.TimeZone(tail.queryDefinition.TimeZone)
+	} else {
+		aggregation = aggregation.TimeZone(localTimeZoneName())
+	}
+	if tail.queryDefinition.AfterDateTime != "" {
+		aggregation = aggregation.ExtendedBoundsMin(tail.queryDefinition.AfterDateTime)
+		if tail.queryDefinition.BeforeDateTime != "" {
+			aggregation = aggregation.ExtendedBoundsMax(tail.queryDefinition.BeforeDateTime)
+		} else {
+			aggregation = aggregation.ExtendedBoundsMax(formatElasticTimeStamp(time.Now().UTC()))
+		}
+	}
+	return aggregation
+}
+
+// Returns the IANA name of the local time zone (e.g. Europe/Zagreb), taken from TZ environment variable or
+// /etc/localtime link, so that buckets on both sides of daylight saving time change are aligned. Falls back to the
+// current UTC offset if the name can't be determined.
+func localTimeZoneName() string {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		if tz == "" {
+			return "UTC"
+		}
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			if _, err := time.LoadLocation(target[i+len("zoneinfo/"):]); err == nil {
+				return target[i+len("zoneinfo/"):]
+			}
+		}
+	}
+	return time.Now().Format("-07:00")
+}
+
+func parseHistogram(aggregations elastic.Aggregations, split bool) (*Histogram, error) {
+	items, found := aggregations.DateHistogram("histogram")
+	if !found {
+		return nil, fmt.Errorf("Histogram aggregation is missing in the response.")
+	}
+	histogram := &Histogram{}
+	bucketIndex := make(map[float64]int)
+	for _, item := range items.Buckets {
+		bucketIndex[item.Key] = len(histogram.Buckets)
+		histogram.Buckets = append(histogram.Buckets, HistogramBucket{
+			Time:  time.Unix(0, int64(item.Key)*int64(time.Millisecond)),
+			Count: item.DocCount,
+		})
+	}
+	if !split {
+		return histogram, nil
+	}
+	terms, found := aggregations.Terms("split")
+	if !found {
+		return nil, fmt.Errorf("Split aggregation is missing in the response.")
+	}
+	histogram.Series = make([]string, 0, len(terms.Buckets)+1)
+	for i := range histogram.Buckets {
+		histogram.Buckets[i].Counts = make([]int64, len(terms.Buckets))
+	}
+	for series, term := range terms.Buckets {
+		histogram.Series = append(histogram.Series, valueString(term.Key))
+		items, found := term.DateHistogram("histogram")
+		if !found {
+			continue
+		}
+		for _, item := range items.Buckets {
+			if i, ok := bucketIndex[item.Key]; ok {
+				histogram.Buckets[i].Counts[series] = item.DocCount
+			}
+		}
+	}
+	//entries with other values of the split field (or without the field) are put into a separate series
+	other := make([]int64, len(histogram.Buckets))
+	hasOther := false
+	for i, bucket := range histogram.Buckets {
+		other[i] = bucket.Count
+		for _, count := range bucket.Counts {
+			other[i] -= count
+		}
+		hasOther = hasOther || other[i] > 0
+	}
+	if hasOther {
+		histogram.Series = append(histogram.Series, histogramOtherSeries)
+		for i := range histogram.Buckets {
+			histogram.Buckets[i].Counts = append(histogram.Buckets[i].Counts, other[i])
+		}
+	}
+	return histogram, nil
+}
+
+func (h *Histogram) maxCount() int64 {
+	var max int64
+	for _, bucket := range h.Buckets {
+		if bucket.Count > max {
+			max = bucket.Count
+		}
+	}
+	return max
+}
+
+// RenderBars renders the histogram as horizontal bar chart with a line per bucket containing time, bar and count.
+// Split histograms are rendered as stacked bars filled with a different character for each of the series, preceded
+// by a legend.
+func (h *Histogram) RenderBars(width int, location *time.Location, layout string) string {
+	var buffer bytes.Buffer
+	max := h.maxCount()
+	countWidth := len(strconv.FormatInt(max, 10))
+	barWidth := width - len(layout) - countWidth - 2
+	if barWidth < 10 {
+		barWidth = 10
+	}
+	if h.Series != nil {
+		legend := make([]string, len(h.Series))
+		for i, series := range h.Series {
+			legend[i] = histogramSeriesChars[i%len(histogramSeriesChars)] + " " + series
+		}
+		buffer.WriteString(strings.Join(legend, "  ") + "\n")
+	}
+	for _, bucket := range h.Buckets {
+		var bar string
+		if h.Series == nil {
+			bar = histogramBar(bucket.Count, max, barWidth)
+		} else {
+			bar = histogramStackedBar(bucket.Counts, max, barWidth)
+		}
+		bar += strings.Repeat(" ", barWidth-utf8.RuneCountInString(bar))
+		buffer.WriteString(fmt.Sprintf("%s %s %*d\n", bucket.Time.In(location).Format(layout), bar, countWidth,
+			bucket.Count))
+	}
+	return buffer.String()
+}
+
+// Returns bar of the length proportional to count, with eighths of the character resolution
+func histogramBar(count int64, max int64, width int) string {
+	if max == 0 {
+		return ""
+	}
+	eighths := count * int64(width) * 8 / max
+	return strings.Repeat(histogramSeriesChars[0], int(eighths/8)) + histogramPartialChars[eighths%8]
+}
+
+// Returns bar consisting of segments for each of the series. Segment boundaries are rounded from cumulative counts,
+// so that the total length of the bar doesn't depend on rounding of the individual segments.
+func histogramStackedBar(counts []int64, max int64, width int) string {
+	if max == 0 {
+		return ""
+	}
+	var bar bytes.Buffer
+	var cumulative int64
+	position := 0
+	for i, count := range counts {
+		cumulative += count
+		end := int((cumulative*int64(width)*2 + max) / (max * 2))
+		bar.WriteString(strings.Repeat(histogramSeriesChars[i%len(histogramSeriesChars)], end-position))
+		position = end
+	}
+	return bar.String()
+}
+
+// RenderSparkline renders the histogram as a sparkline (a line per series for split histograms) followed by the
+// time range and total count
+func (h *Histogram) RenderSparkline(location *time.Location, layout string) string {
+	if len(h.Buckets) == 0 {
+		return ""
+	}
+	max := h.maxCount()
+	timeRange := fmt.Sprintf("%s - %s", h.Buckets[0].Time.In(location).Format(layout),
+		h.Buckets[len(h.Buckets)-1].Time.In(location).Format(layout))
+	if h.Series == nil {
+		counts := make([]int64, len(h.Buckets))
+		var total int64
+		for i, bucket := range h.Buckets {
+			counts[i] = bucket.Count
+			total += bucket.Count
+		}
+		return fmt.Sprintf("%s  %s  total %d, max %d\n", sparkline(counts, max), timeRange, total, max)
+	}
+	labelWidth := 0
+	for _, series := range h.Series {
+		if utf8.RuneCountInString(series) > labelWidth {
+			labelWidth = utf8.RuneCountInString(series)
+		}
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(timeRange + "\n")
+	for s, series := range h.Series {
+		counts := make([]int64, len(h.Buckets))
+		var total int64
+		for i, bucket := range h.Buckets {
+			counts[i] = bucket.Counts[s]
+			total += bucket.Counts[s]
+		}
+		padding := strings.Repeat(" ", labelWidth-utf8.RuneCountInString(series))
+		buffer.WriteString(fmt.Sprintf("%s%s  %s  total %d\n", series, padding, sparkline(counts, max), total))
+	}
+	return buffer.String()
+}
+
+// Returns sparkline of the counts scaled to max. Zero counts are rendered as spaces.
+func sparkline(counts []int64, max int64) string {
+	var line bytes.Buffer
+	for _, count := range counts {
+		if count <= 0 || max == 0 {
+			line.WriteString(" ")
+			continue
+		}
+		level := (count*int64(len(sparklineChars)) + max - 1) / max
+		line.WriteString(sparklineChars[level-1])
+	}
+	return line.String()
+}
+
+// Returns the layout of bucket times suitable for the interval - date only for intervals of a day or longer
+func histogramTimeLayout(interval string) string {
+	switch {
+	case strings.HasSuffix(interval, "s") || strings.HasPrefix(interval, "second"):
+		return "2006-01-02 15:04:05"
+	case strings.HasSuffix(interval, "d") || strings.HasSuffix(interval, "w") ||
+		strings.HasSuffix(interval, "M") || strings.HasSuffix(interval, "y") ||
+		interval == "day" || interval == "week" || interval == "month" || interval == "quarter" || interval == "year":
+		return "2006-01-02"
+	}
+	return "2006-01-02 15:04"
+}
+
+// Returns width of the terminal, or 80 if output is not a terminal
+func terminalWidth() int {
+	if width, _, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// Returns the histogram command, which renders number of matching entries over time as ASCII bar chart or sparkline
+func histogramCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:      "histogram",
+		Usage:     "Show the number of entries matching the query, filters and date range over time as a bar chart or sparkline",
+		ArgsUsage: "[query-string]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "interval",
+				Value: "1m",
+				Usage: "Histogram interval (examples: 30s, 1m, 15m, 1h, 1d)",
+			},
+			cli.StringFlag{
+				Name:  "split-by",
+				Value: "",
+				Usage: "Split the counts by top values of the field (example: --split-by host)",
+			},
+			cli.IntFlag{
+				Name:  "top",
+				Value: 5,
+				Usage: "Number of top values of the split field shown separately, other values are shown as 'other'",
+			},
+			cli.BoolFlag{
+				Name:  "sparkline",
+				Usage: "Render the histogram as a sparkline instead of a bar chart",
+			},
+			cli.IntFlag{
+				Name:  "width",
+				Value: 0,
+				Usage: "Width of the bar chart (defaults to terminal width)",
+			},
+		},
+		Action: func(c *cli.Context) {
+			prepareConfiguration(config, globalFlags(c), c.Args())
+			location, err := config.QueryDefinition.DisplayLocation()
+			if err != nil {
+				Error.Fatalln(err)
+			}
+			histogram, err := NewTail(config).Histogram(c.String("interval"), c.String("split-by"), c.Int("top"))
+			if err != nil {
+				Error.Fatalln("Error in executing histogram query.", err)
+			}
+			layout := histogramTimeLayout(c.String("interval"))
+			if c.Bool("sparkline") {
+				fmt.Print(histogram.RenderSparkline(location, layout))
+				return
+			}
+			width := c.Int("width")
+			if width <= 0 {
+				width = terminalWidth()
+			}
+			fmt.Print(histogram.RenderBars(width, location, layout))
+		},
+	}
+}
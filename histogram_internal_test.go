@@ -0,0 +1,118 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"os"
+	"testing"
+	"time"
+)
+
+const testHistogramResponse = `{
+  "histogram": {"buckets": [
+    {"key": 1467378000000, "doc_count": 10},
+    {"key": 1467378060000, "doc_count": 0},
+    {"key": 1467378120000, "doc_count": 4}
+  ]},
+  "split": {"sum_other_doc_count": 3, "buckets": [
+    {"key": "web-1", "doc_count": 8, "histogram": {"buckets": [
+      {"key": 1467378000000, "doc_count": 6}, {"key": 1467378060000, "doc_count": 0}, {"key": 1467378120000, "doc_count": 2}]}},
+    {"key": "web-2", "doc_count": 3, "histogram": {"buckets": [
+      {"key": 1467378000000, "doc_count": 3}]}}
+  ]}
+}`
+
+func testHistogram(t *testing.T, split bool) *Histogram {
+	var aggregations elastic.Aggregations
+	if err := json.Unmarshal([]byte(testHistogramResponse), &aggregations); err != nil {
+		t.Fatal(err)
+	}
+	histogram, err := parseHistogram(aggregations, split)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return histogram
+}
+
+func TestParseHistogram(t *testing.T) {
+	histogram := testHistogram(t, false)
+	tu.AssertEqualsInt(t, 3, len(histogram.Buckets))
+	tu.AssertEqualsString(t, "2016-07-01T13:00:00Z", histogram.Buckets[0].Time.UTC().Format(time.RFC3339))
+	tu.AssertEqualsInt(t, 10, int(histogram.Buckets[0].Count))
+	if histogram.Series != nil || histogram.Buckets[0].Counts != nil {
+		tu.Fail(t, "Expected no series")
+	}
+
+	histogram = testHistogram(t, true)
+	tu.AssertEqualsInt(t, 3, len(histogram.Series))
+	tu.AssertEqualsString(t, "web-1", histogram.Series[0])
+	tu.AssertEqualsString(t, "other", histogram.Series[2])
+	expected := [][]int64{{6, 3, 1}, {0, 0, 0}, {2, 0, 2}}
+	for i, bucket := range histogram.Buckets {
+		for s := range expected[i] {
+			tu.AssertEqualsInt(t, int(expected[i][s]), int(bucket.Counts[s]))
+		}
+	}
+}
+
+func TestRenderHistogram(t *testing.T) {
+	layout := histogramTimeLayout("1m")
+	tu.AssertEqualsString(t, ""+
+		"2016-07-01 13:00 ██████████ 10\n"+
+		"2016-07-01 13:01             0\n"+
+		"2016-07-01 13:02 ████        4\n",
+		testHistogram(t, false).RenderBars(30, time.UTC, layout))
+	tu.AssertEqualsString(t, ""+
+		"█ web-1  ▓ web-2  ▒ other\n"+
+		"2016-07-01 13:00 ██████▓▓▓▒ 10\n"+
+		"2016-07-01 13:01             0\n"+
+		"2016-07-01 13:02 ██▒▒        4\n",
+		testHistogram(t, true).RenderBars(30, time.UTC, layout))
+	tu.AssertEqualsString(t, "█ ▄  2016-07-01 13:00 - 2016-07-01 13:02  total 14, max 10\n",
+		testHistogram(t, false).RenderSparkline(time.UTC, layout))
+	tu.AssertEqualsString(t, ""+
+		"2016-07-01 13:00 - 2016-07-01 13:02\n"+
+		"web-1  ▅ ▂  total 8\n"+
+		"web-2  ▃    total 3\n"+
+		"other  ▁ ▂  total 3\n",
+		testHistogram(t, true).RenderSparkline(time.UTC, layout))
+}
+
+func TestHistogramTimeLayout(t *testing.T) {
+	tu.AssertEqualsString(t, "2006-01-02 15:04:05", histogramTimeLayout("30s"))
+	tu.AssertEqualsString(t, "2006-01-02 15:04", histogramTimeLayout("1h"))
+	tu.AssertEqualsString(t, "2006-01-02", histogramTimeLayout("1d"))
+	tu.AssertEqualsString(t, "2006-01-02", histogramTimeLayout("1M"))
+}
+
+func TestHistogramLocalTimeZone(t *testing.T) {
+	defer func(tz string, set bool) {
+		if set {
+			os.Setenv("TZ", tz)
+		} else {
+			os.Unsetenv("TZ")
+		}
+	}(os.LookupEnv("TZ"))
+	os.Setenv("TZ", "Europe/Zagreb")
+	tu.AssertEqualsString(t, "Europe/Zagreb", localTimeZoneName())
+
+	//local time zone is passed by name, so that buckets after daylight saving time change are aligned as well
+	source, err := dryRunTail().dateHistogramAggregation("1d").Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceJson, _ := json.Marshal(source)
+	var parsed struct {
+		DateHistogram struct {
+			TimeZone string `json:"time_zone"`
+		} `json:"date_histogram"`
+	}
+	json.Unmarshal(sourceJson, &parsed)
+	tu.AssertEqualsString(t, "Europe/Zagreb", parsed.DateHistogram.TimeZone)
+}
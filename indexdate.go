@@ -0,0 +1,150 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date format of logstash's one-per-day indices (e.g. logstash-2016.01.02)
+const defaultIndexDateFormat = "yyyy.MM.dd"
+
+// Granularities of the index periods, from the finest
+const (
+	granularityHour  = "hour"
+	granularityDay   = "day"
+	granularityWeek  = "week"
+	granularityMonth = "month"
+	granularityYear  = "year"
+)
+
+// Date format tokens, both Joda (as used by logstash and elasticsearch) and Go style, mapped to the date component
+// they represent. Longer tokens need to come first.
+var indexDateTokens = []struct {
+	token     string
+	component string
+}{
+	{"yyyy", "year"}, {"YYYY", "year"}, {"xxxx", "year"}, {"2006", "year"},
+	{"MM", "month"}, {"01", "month"},
+	{"dd", "day"}, {"02", "day"},
+	{"HH", "hour"}, {"15", "hour"},
+	{"ww", "week"},
+}
+
+// IndexDateFormat describes how dates are embedded in the index names, and how long is the period covered by each
+// index (e.g. an hour for app-2024.05.01.13, a week for app-2024.w18 or a month for app-2024.05)
+type IndexDateFormat struct {
+	Format      string
+	Granularity string
+	regexp      *regexp.Regexp
+	components  []string //date components in order of regexp's groups
+}
+
+// ParseIndexDateFormat parses index date format given as Joda (yyyy, MM, dd, HH, ww and 'quoted' literals) or Go
+// (2006, 01, 02, 15) layout. Empty format stands for the default yyyy.MM.dd.
+func ParseIndexDateFormat(format string) (*IndexDateFormat, error) {
+	if format == "" {
+		format = defaultIndexDateFormat
+	}
+	var pattern bytes.Buffer
+	components := make([]string, 0, 4)
+	for rest := format; rest != ""; {
+		if rest[0] == '\'' {
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated quote in index date format %s", format)
+			}
+			pattern.WriteString(regexp.QuoteMeta(rest[1 : end+1]))
+			rest = rest[end+2:]
+			continue
+		}
+		matched := false
+		for _, t := range indexDateTokens {
+			if strings.HasPrefix(rest, t.token) {
+				if t.component == "year" {
+					pattern.WriteString(`(\d{4})`)
+				} else {
+					pattern.WriteString(`(\d{2})`)
+				}
+				components = append(components, t.component)
+				rest = rest[len(t.token):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			pattern.WriteString(regexp.QuoteMeta(rest[:1]))
+			rest = rest[1:]
+		}
+	}
+	has := func(component string) bool { return containsString(components, component) }
+	if !has("year") {
+		return nil, fmt.Errorf("Index date format %s needs to contain the year (yyyy)", format)
+	}
+	if has("week") && (has("month") || has("day")) {
+		return nil, fmt.Errorf("Index date format %s can't combine week with month or day", format)
+	}
+	dateFormat := &IndexDateFormat{Format: format, regexp: regexp.MustCompile(pattern.String()), components: components}
+	switch {
+	case has("hour"):
+		dateFormat.Granularity = granularityHour
+	case has("day"):
+		dateFormat.Granularity = granularityDay
+	case has("week"):
+		dateFormat.Granularity = granularityWeek
+	case has("month"):
+		dateFormat.Granularity = granularityMonth
+	default:
+		dateFormat.Granularity = granularityYear
+	}
+	return dateFormat, nil
+}
+
+// Period returns the start (inclusive) and end (exclusive) of the period covered by the index, in UTC
+func (f *IndexDateFormat) Period(index string) (time.Time, time.Time, error) {
+	match := f.regexp.FindStringSubmatch(index)
+	if match == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("Failed to extract date from index %s using format %s",
+			index, f.Format)
+	}
+	values := map[string]int{"month": 1, "day": 1}
+	for i, component := range f.components {
+		values[component], _ = strconv.Atoi(match[i+1])
+	}
+	if values["month"] < 1 || values["month"] > 12 || values["day"] < 1 || values["day"] > 31 ||
+		values["hour"] > 23 || f.Granularity == granularityWeek && (values["week"] < 1 || values["week"] > 53) {
+		return time.Time{}, time.Time{}, fmt.Errorf("Invalid date in index %s using format %s", index, f.Format)
+	}
+	var start time.Time
+	if f.Granularity == granularityWeek {
+		start = isoWeekStart(values["year"], values["week"])
+	} else {
+		start = time.Date(values["year"], time.Month(values["month"]), values["day"], values["hour"], 0, 0, 0, time.UTC)
+	}
+	switch f.Granularity {
+	case granularityHour:
+		return start, start.Add(time.Hour), nil
+	case granularityDay:
+		return start, start.AddDate(0, 0, 1), nil
+	case granularityWeek:
+		return start, start.AddDate(0, 0, 7), nil
+	case granularityMonth:
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	return start, start.AddDate(1, 0, 0), nil
+}
+
+// Returns the Monday starting the ISO week of the year (week 1 is the week containing January 4th)
+func isoWeekStart(year, week int) time.Time {
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	weekday := int(jan4.Weekday()+6) % 7 //days since Monday
+	return jan4.AddDate(0, 0, -weekday+(week-1)*7)
+}
@@ -0,0 +1,92 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"strings"
+	"testing"
+)
+
+func periodString(t *testing.T, format string, index string) string {
+	dateFormat, err := ParseIndexDateFormat(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end, err := dateFormat.Period(index)
+	if err != nil {
+		return err.Error()
+	}
+	return start.Format(indexRangeLayout) + " - " + end.Format(indexRangeLayout) + " " + dateFormat.Granularity
+}
+
+func TestIndexDateFormatPeriod(t *testing.T) {
+	tu.AssertEqualsString(t, "2016-06-17 00:00:00 - 2016-06-18 00:00:00 day",
+		periodString(t, "", "logstash-2016.06.17"))
+	tu.AssertEqualsString(t, "2024-05-01 13:00:00 - 2024-05-01 14:00:00 hour",
+		periodString(t, "yyyy.MM.dd.HH", "app-2024.05.01.13"))
+	tu.AssertEqualsString(t, "2024-04-29 00:00:00 - 2024-05-06 00:00:00 week",
+		periodString(t, "yyyy.'w'ww", "app-2024.w18"))
+	tu.AssertEqualsString(t, "2021-01-04 00:00:00 - 2021-01-11 00:00:00 week",
+		periodString(t, "xxxx-'w'ww", "app-2021-w01"))
+	tu.AssertEqualsString(t, "2024-05-01 00:00:00 - 2024-06-01 00:00:00 month",
+		periodString(t, "yyyy.MM", "app-2024.05"))
+	tu.AssertEqualsString(t, "2024-05-01 00:00:00 - 2024-06-01 00:00:00 month",
+		periodString(t, "2006-01", "app-2024-05"))
+	tu.AssertEqualsString(t, "2024-01-01 00:00:00 - 2025-01-01 00:00:00 year",
+		periodString(t, "yyyy", "archive-2024"))
+	tu.AssertEqualsString(t, "Failed to extract date from index app-2024.05 using format yyyy.MM.dd",
+		periodString(t, "yyyy.MM.dd", "app-2024.05"))
+	tu.AssertEqualsString(t, "Invalid date in index app-2024.13 using format yyyy.MM",
+		periodString(t, "yyyy.MM", "app-2024.13"))
+}
+
+func TestParseIndexDateFormatErrors(t *testing.T) {
+	for _, format := range []string{"MM.dd", "yyyy.MM.'w", "yyyy.ww.dd"} {
+		if _, err := ParseIndexDateFormat(format); err == nil {
+			tu.Fail(t, "Expected error for format "+format)
+		}
+	}
+}
+
+// Returns comma separated indices found for the date range, failing the test on error
+func dateRangeIndices(t *testing.T, indices []string, indexPattern string, dateFormat *IndexDateFormat, startDate string,
+	endDate string) string {
+	result, err := findIndicesForDateRange(indices, indexPattern, dateFormat, startDate, endDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestFindIndicesForDateRangeGranularity(t *testing.T) {
+	hourly, _ := ParseIndexDateFormat("yyyy.MM.dd.HH")
+	indices := []string{"app-2024.05.01.12", "app-2024.05.01.13", "app-2024.05.01.14", "app-2024.05.01.15"}
+	tu.AssertEqualsString(t, "app-2024.05.01.13,app-2024.05.01.14", dateRangeIndices(t, indices,
+		"app-.*", hourly, "2024-05-01T13:30:00Z", "2024-05-01T14:10:00Z"))
+
+	weekly, _ := ParseIndexDateFormat("yyyy.'w'ww")
+	indices = []string{"app-2024.w17", "app-2024.w18", "app-2024.w19"}
+	tu.AssertEqualsString(t, "app-2024.w17,app-2024.w18", dateRangeIndices(t, indices,
+		"app-.*", weekly, "2024-04-28T00:00:00Z", "2024-05-01T00:00:00Z"))
+
+	monthly, _ := ParseIndexDateFormat("yyyy.MM")
+	indices = []string{"app-2024.04", "app-2024.05", "app-2024.06"}
+	tu.AssertEqualsString(t, "app-2024.05", dateRangeIndices(t, indices,
+		"app-.*", monthly, "2024-05-10", "2024-05-20"))
+}
+
+func TestFindIndicesForDateRangeErrors(t *testing.T) {
+	daily, _ := ParseIndexDateFormat("")
+	if _, err := findIndicesForDateRange([]string{"app-2024.05.01", "app-current"}, "app-.*", daily,
+		"2024-05-01", "2024-05-02"); err == nil {
+		tu.Fail(t, "Expected error for index without date in its name")
+	}
+	if _, err := findIndicesForDateRange([]string{"app-2024.05.01"}, "app-.*", daily,
+		"yesterday", "2024-05-02"); err == nil {
+		tu.Fail(t, "Expected error for invalid start date")
+	}
+}
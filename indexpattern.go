@@ -0,0 +1,93 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IndexPatterns is a list of index name patterns (regular expressions), given as comma separated list such as
+// app-.*,nginx-.*,-app-test-.* in which patterns prefixed with - exclude indices matched by the other patterns
+type IndexPatterns struct {
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+}
+
+// ParseIndexPatterns parses comma separated list of index patterns. Commas inside {} (regexp repetition) don't
+// separate the patterns.
+func ParseIndexPatterns(patterns string) (*IndexPatterns, error) {
+	result := &IndexPatterns{}
+	for _, pattern := range splitIndexPatterns(patterns) {
+		exclude := strings.HasPrefix(pattern, "-")
+		if exclude {
+			pattern = pattern[1:]
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid index pattern %s: %s", pattern, err)
+		}
+		if exclude {
+			result.Exclude = append(result.Exclude, compiled)
+		} else {
+			result.Include = append(result.Include, compiled)
+		}
+	}
+	if len(result.Include) == 0 {
+		return nil, fmt.Errorf("Index pattern %s doesn't include any indices", patterns)
+	}
+	return result, nil
+}
+
+func splitIndexPatterns(patterns string) []string {
+	result := make([]string, 0, 1)
+	depth, start := 0, 0
+	for i, c := range patterns {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, patterns[start:i])
+				start = i + 1
+			}
+		}
+	}
+	result = append(result, patterns[start:])
+	nonEmpty := result[:0]
+	for _, pattern := range result {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			nonEmpty = append(nonEmpty, pattern)
+		}
+	}
+	return nonEmpty
+}
+
+// Matches returns whether the index is matched by any of the included patterns and none of the excluded ones
+func (p *IndexPatterns) Matches(index string) bool {
+	for i := range p.Include {
+		if p.MatchesInclude(i, index) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesInclude returns whether the index is matched by i-th included pattern and none of the excluded ones
+func (p *IndexPatterns) MatchesInclude(i int, index string) bool {
+	if !p.Include[i].MatchString(index) {
+		return false
+	}
+	for _, exclude := range p.Exclude {
+		if exclude.MatchString(index) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"strings"
+	"testing"
+)
+
+func TestParseIndexPatterns(t *testing.T) {
+	patterns, err := ParseIndexPatterns("app-.*, nginx-[0-9]{4,}.*,-app-test-.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 2, len(patterns.Include))
+	tu.AssertEqualsInt(t, 1, len(patterns.Exclude))
+	tu.AssertEqualsString(t, "nginx-[0-9]{4,}.*", patterns.Include[1].String())
+
+	matched := make([]string, 0)
+	for _, index := range []string{"app-2016.01.01", "app-test-2016.01.01", "nginx-2016.01.01", "nginx-old", "db-1"} {
+		if patterns.Matches(index) {
+			matched = append(matched, index)
+		}
+	}
+	tu.AssertEqualsString(t, "app-2016.01.01,nginx-2016.01.01", strings.Join(matched, ","))
+
+	for _, invalid := range []string{"-app-test-.*", "app-(", ""} {
+		if _, err := ParseIndexPatterns(invalid); err == nil {
+			tu.Fail(t, "Expected error for index pattern "+invalid)
+		}
+	}
+}
+
+func TestFindLastIndices(t *testing.T) {
+	indices := []string{
+		"app-2016.06.15", "app-2016.06.16", "app-test-2016.06.17",
+		"nginx-2016.06.14", "nginx-2016.06.15",
+	}
+	lastIndices, err := findLastIndices(indices, "app-.*,nginx-.*,-app-test-.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "app-2016.06.16,nginx-2016.06.15", strings.Join(lastIndices, ","))
+	lastIndices, _ = findLastIndices(indices, "app-.*")
+	tu.AssertEqualsString(t, "app-test-2016.06.17", strings.Join(lastIndices, ","))
+	if _, err := findLastIndices(indices, "-app-test-.*"); err == nil {
+		tu.Fail(t, "Expected error for index pattern without included indices")
+	}
+
+	dateFormat, _ := ParseIndexDateFormat("")
+	tu.AssertEqualsString(t, "app-2016.06.15,app-2016.06.16,nginx-2016.06.15", dateRangeIndices(t,
+		indices, "app-.*,nginx-.*,-app-test-.*", dateFormat, "2016-06-15T12:00:00Z", "2016-06-17T00:00:00Z"))
+}
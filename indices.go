@@ -0,0 +1,246 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"gopkg.in/olivere/elastic.v5"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// IndexInfo describes an index matching the index pattern
+type IndexInfo struct {
+	Name      string
+	Health    string
+	Status    string
+	DocsCount int
+	StoreSize string
+	Created   string
+	Covers    string //date range elktail believes the index covers
+	Used      bool   //whether the index is selected for searching by the current invocation
+}
+
+// ResolvedIndices lists indices, aliases and data streams an index expression resolves to, as returned by
+// elasticsearch's _resolve/index API (elasticsearch 7.9 or newer)
+type ResolvedIndices struct {
+	Indices []struct {
+		Name string `json:"name"`
+	} `json:"indices"`
+	Aliases []struct {
+		Name string `json:"name"`
+	} `json:"aliases"`
+	DataStreams []struct {
+		Name string `json:"name"`
+	} `json:"data_streams"`
+}
+
+// Describes what the expression resolved to, e.g. "3 indices, aliases: logs-app, data streams: logs-nginx-default"
+func (r *ResolvedIndices) String() string {
+	parts := []string{fmt.Sprintf("%d indices", len(r.Indices))}
+	if len(r.Aliases) > 0 {
+		names := make([]string, len(r.Aliases))
+		for i, alias := range r.Aliases {
+			names[i] = alias.Name
+		}
+		parts = append(parts, "aliases: "+strings.Join(names, ", "))
+	}
+	if len(r.DataStreams) > 0 {
+		names := make([]string, len(r.DataStreams))
+		for i, dataStream := range r.DataStreams {
+			names[i] = dataStream.Name
+		}
+		parts = append(parts, "data streams: "+strings.Join(names, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Resolves index expression (wildcards, aliases, data streams and exclusions) using the _resolve/index API
+func (tail *Tail) resolveIndex(expression string) (*ResolvedIndices, error) {
+	response, err := tail.client.PerformRequest(context.Background(), "GET",
+		"/_resolve/index/"+url.PathEscape(expression), url.Values{"expand_wildcards": {"open"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resolved ResolvedIndices
+	if err := json.Unmarshal(response.Body, &resolved); err != nil {
+		return nil, fmt.Errorf("Failed parsing resolve index response: %s", err)
+	}
+	return &resolved, nil
+}
+
+// Indices returns indices matching the index pattern (or the indices the alias, data stream or wildcard expression
+// resolves to), sorted by name, and marks the ones selected for searching
+func (tail *Tail) Indices(target *SearchTarget) ([]IndexInfo, error) {
+	direct := target.IndexStrategy == indexStrategyAlias || target.IndexStrategy == indexStrategyWildcard
+	var rows elastic.CatIndicesResponse
+	var err error
+	if direct {
+		rows, err = tail.catIndices(target.IndexPattern)
+	} else {
+		rows, err = tail.catIndices("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var patterns *IndexPatterns
+	if !direct {
+		if patterns, err = ParseIndexPatterns(target.IndexPattern); err != nil {
+			return nil, err
+		}
+	}
+	matching := rows[:0]
+	for _, row := range rows {
+		if direct || patterns.Matches(row.Index) {
+			matching = append(matching, row)
+		}
+	}
+	covers := make(map[string]string)
+	if direct || target.IndexStrategy == indexStrategyRollover {
+		expression := ""
+		if direct {
+			expression = target.IndexPattern
+		}
+		ranges, err := tail.indexRanges(matching, expression)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ranges {
+			covers[r.index] = r.String()
+		}
+	} else {
+		dateFormat, err := ParseIndexDateFormat(target.IndexDateFormat)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range matching {
+			covers[row.Index] = indexCoverage(row.Index, dateFormat)
+		}
+	}
+	result := make([]IndexInfo, 0, len(matching))
+	for _, row := range matching {
+		result = append(result, IndexInfo{
+			Name:      row.Index,
+			Health:    row.Health,
+			Status:    row.Status,
+			DocsCount: row.DocsCount,
+			StoreSize: row.StoreSize,
+			Created:   row.CreationDateString,
+			Covers:    covers[row.Index],
+			Used:      direct || containsString(tail.indices, row.Index),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Returns the period covered by the index, as determined from the date in its name
+func indexCoverage(index string, dateFormat *IndexDateFormat) string {
+	start, end, err := dateFormat.Period(index)
+	if err != nil {
+		return "unknown (no date in name)"
+	}
+	return fmt.Sprintf("%s - %s (%s)", start.Format(indexRangeLayout), end.Format(indexRangeLayout),
+		dateFormat.Granularity)
+}
+
+// Renders indices as a table, with the ones used by the current invocation marked with *
+func renderIndices(indices []IndexInfo) string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "USED\tINDEX\tHEALTH\tSTATUS\tDOCS\tSIZE\tCREATED\tCOVERS")
+	for _, index := range indices {
+		used := ""
+		if index.Used {
+			used = "*"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", used, index.Name, index.Health, index.Status,
+			index.DocsCount, index.StoreSize, index.Created, index.Covers)
+	}
+	writer.Flush()
+	return buffer.String()
+}
+
+// Describes how the current invocation selects indices
+func describeIndexSelection(config *Configuration) string {
+	queryDefinition := &config.QueryDefinition
+	if config.SearchTarget.IndexStrategy == indexStrategyAlias {
+		return fmt.Sprintf("Alias or data stream %s is searched directly.", config.SearchTarget.IndexPattern)
+	}
+	if config.SearchTarget.IndexStrategy == indexStrategyWildcard {
+		return fmt.Sprintf("Index expression %s is resolved by elasticsearch (unavailable indices are ignored), "+
+			"entries are found by the date range.", config.SearchTarget.IndexPattern)
+	}
+	covering := "indices covering the range (by the dates in their names) are used."
+	if config.SearchTarget.IndexStrategy == indexStrategyRollover {
+		covering = "indices with entries in the range are used."
+	}
+	if !queryDefinition.IsDateTimeFiltered() {
+		return "No date range given - only the latest index is used."
+	}
+	after, before := queryDefinition.AfterDateTime, queryDefinition.BeforeDateTime
+	if after == "" {
+		after = "the latest index"
+	}
+	if before == "" {
+		before = "now"
+	}
+	return fmt.Sprintf("Date range from %s to %s - %s", after, before, covering)
+}
+
+func indexStrategyName(config *Configuration) string {
+	if config.SearchTarget.IndexStrategy == "" {
+		return indexStrategyDate
+	}
+	return config.SearchTarget.IndexStrategy
+}
+
+// Returns the indices command, which lists indices matching the index pattern and marks the ones that would be
+// searched with the given options
+func indicesCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:  "indices",
+		Usage: "List indices matching the index pattern, marking the ones searched with the given options (such as -a and -b)",
+		Action: func(c *cli.Context) {
+			prepareConfiguration(config, globalFlags(c), nil)
+			tail := NewTail(config)
+			indices, err := tail.Indices(&config.SearchTarget)
+			if err != nil {
+				Error.Fatalln("Could not fetch indices.", err)
+			}
+			fmt.Printf("Index pattern: %s (%s strategy)\n", config.SearchTarget.IndexPattern, indexStrategyName(config))
+			fmt.Println(describeIndexSelection(config))
+			if config.SearchTarget.IndexStrategy == indexStrategyWildcard {
+				if resolved, err := tail.resolveIndex(config.SearchTarget.IndexPattern); err != nil {
+					Info.Printf("Could not resolve index expression: %s\n", err)
+				} else {
+					fmt.Printf("Resolves to %s\n", resolved)
+				}
+			}
+			if len(indices) == 0 {
+				fmt.Println("No indices match the index pattern.")
+				return
+			}
+			fmt.Println()
+			fmt.Print(renderIndices(indices))
+			used := 0
+			for _, index := range indices {
+				if index.Used {
+					used++
+				}
+			}
+			if used == 0 {
+				fmt.Println("\nNone of the indices covers the date range, so no entries will be found.")
+			}
+		},
+	}
+}
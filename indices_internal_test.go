@@ -0,0 +1,109 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestIndices(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"index": "logstash-2016.01.02", "health": "green", "status": "open", "docs.count": "1200",
+				"store.size": "1.2mb", "creation.date.string": "2016-01-02T00:00:01.000Z"},
+			{"index": ".kibana", "health": "green", "status": "open", "docs.count": "3",
+				"store.size": "10kb", "creation.date.string": "2015-12-01T10:00:00.000Z"},
+			{"index": "logstash-2016.01.01", "health": "yellow", "status": "open", "docs.count": "800",
+				"store.size": "900kb", "creation.date.string": "2016-01-01T00:00:02.000Z"},
+			{"index": "logstash-archive", "health": "green", "status": "open", "docs.count": "5",
+				"store.size": "20kb", "creation.date.string": "2016-01-05T08:00:00.000Z"}
+		]`))
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+	tail.indices = []string{"logstash-2016.01.02"}
+
+	indices, err := tail.Indices(&SearchTarget{IndexPattern: "logstash-.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, ""+
+		"USED  INDEX                HEALTH  STATUS  DOCS  SIZE   CREATED                   COVERS\n"+
+		"      logstash-2016.01.01  yellow  open    800   900kb  2016-01-01T00:00:02.000Z  2016-01-01 00:00:00 - 2016-01-02 00:00:00 (day)\n"+
+		"*     logstash-2016.01.02  green   open    1200  1.2mb  2016-01-02T00:00:01.000Z  2016-01-02 00:00:00 - 2016-01-03 00:00:00 (day)\n"+
+		"      logstash-archive     green   open    5     20kb   2016-01-05T08:00:00.000Z  unknown (no date in name)\n",
+		renderIndices(indices))
+}
+
+func TestDescribeIndexSelection(t *testing.T) {
+	tu.AssertEqualsString(t, "No date range given - only the latest index is used.",
+		describeIndexSelection(&Configuration{}))
+	tu.AssertEqualsString(t, "Date range from 2016-01-01T00:00:00Z to now - indices covering the range (by the dates in their names) are used.",
+		describeIndexSelection(&Configuration{QueryDefinition: QueryDefinition{AfterDateTime: "2016-01-01T00:00:00Z"}}))
+	tu.AssertEqualsString(t, "Alias or data stream logs-app is searched directly.",
+		describeIndexSelection(&Configuration{SearchTarget: SearchTarget{IndexPattern: "logs-app", IndexStrategy: "alias"}}))
+}
+
+func TestResolveIndex(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"indices": [{"name": "logs-app-000001"}, {"name": ".ds-logs-nginx-default-000001"}],
+			"aliases": [{"name": "logs-app", "indices": ["logs-app-000001"]}],
+			"data_streams": [{"name": "logs-nginx-default", "backing_indices": [".ds-logs-nginx-default-000001"]}]}`))
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+
+	resolved, err := tail.resolveIndex("logs-*,-logs-old-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "/_resolve/index/logs-*,-logs-old-*", path)
+	tu.AssertEqualsString(t, "2 indices, aliases: logs-app, data streams: logs-nginx-default", resolved.String())
+}
+
+func TestLenientIndices(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	var path, query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		w.Write([]byte(`{"count": 5}`))
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+	tail.selectIndices(&Configuration{SearchTarget: SearchTarget{IndexPattern: "logs-*", IndexStrategy: "wildcard"}})
+
+	count, err := tail.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 5, int(count))
+	tu.AssertEqualsString(t, "/logs-*/_count", path)
+	tu.AssertEqualsString(t, "allow_no_indices=true&ignore_unavailable=true", query)
+}
@@ -0,0 +1,454 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"strings"
+	"unicode"
+)
+
+// Supported query languages of the query terms
+const (
+	queryLanguageLucene = "lucene"
+	queryLanguageKQL    = "kql"
+)
+
+// TermsQuery builds query from the query terms according to the query language - Lucene query string query or query
+// parsed from KQL. Query matches all entries if there are no terms.
+func (q *QueryDefinition) TermsQuery() (elastic.Query, error) {
+	terms := strings.Join(q.Terms, " ")
+	switch q.QueryLanguage {
+	case "", queryLanguageLucene:
+		if len(q.Terms) == 0 {
+			Trace.Print("Running query match all query.")
+			return elastic.NewMatchAllQuery(), nil
+		}
+		Trace.Printf("Running query string query: %s", terms)
+		return elastic.NewQueryStringQuery(terms), nil
+	case queryLanguageKQL:
+		Trace.Printf("Running KQL query: %s", terms)
+		return ParseKQL(terms)
+	}
+	return nil, fmt.Errorf("Unknown query language %s (supported languages are lucene and kql).", q.QueryLanguage)
+}
+
+// Characters that end unquoted KQL values (unless escaped with backslash)
+const kqlSpecialChars = `\():<>"{}`
+
+// Characters that need to be escaped in Lucene query strings
+const luceneSpecialChars = `+-=&|><!(){}[]^"~*?:\/`
+
+// KQLError is returned when KQL query can not be parsed. It points at the column (1-based) where the problem is.
+type KQLError struct {
+	Query   string
+	Column  int
+	Message string
+}
+
+func (e *KQLError) Error() string {
+	return fmt.Sprintf("Invalid KQL query, %s at column %d:\n  %s\n  %s^", e.Message, e.Column, e.Query,
+		strings.Repeat(" ", e.Column-1))
+}
+
+// Single character of a KQL value. Wildcard is set for unescaped * characters.
+type kqlChar struct {
+	r        rune
+	wildcard bool
+}
+
+// Value (or field name) in KQL query
+type kqlValue struct {
+	chars  []kqlChar
+	quoted bool
+}
+
+func (v *kqlValue) String() string {
+	runes := make([]rune, len(v.chars))
+	for i, c := range v.chars {
+		runes[i] = c.r
+	}
+	return string(runes)
+}
+
+func (v *kqlValue) hasWildcard() bool {
+	for _, c := range v.chars {
+		if c.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the value as Lucene query string - special characters are escaped, except for wildcards. Quoted values
+// are turned into phrases.
+func (v *kqlValue) queryString() string {
+	var result []rune
+	for _, c := range v.chars {
+		if !c.wildcard && strings.ContainsRune(luceneSpecialChars, c.r) {
+			result = append(result, '\\')
+		}
+		result = append(result, c.r)
+	}
+	if v.quoted {
+		return `"` + string(result) + `"`
+	}
+	return string(result)
+}
+
+// Recursive descent parser of the Kibana Query Language, following Kibana's grammar:
+//  OrQuery     = AndQuery ("or" AndQuery)*
+//  AndQuery    = NotQuery ("and" NotQuery)*
+//  NotQuery    = "not" SubQuery | SubQuery
+//  SubQuery    = "(" OrQuery ")" | Field ":" "{" OrQuery "}" | Field ":" ValueList | Field RangeOp Value | Value
+//  ValueList   = "(" OrValues ")" | Value, where OrValues are values combined with or, and and not
+// Unquoted values may contain whitespace (e.g. message:connection refused), they end at special characters and
+// and/or/not keywords.
+type kqlParser struct {
+	query string
+	input []rune
+	pos   int
+}
+
+// ParseKQL parses query written in Kibana Query Language into elasticsearch query. Empty query matches all entries.
+func ParseKQL(query string) (elastic.Query, error) {
+	p := &kqlParser{query: query, input: []rune(query)}
+	p.skipSpace()
+	if p.eof() {
+		return elastic.NewMatchAllQuery(), nil
+	}
+	result, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("expected and, or or end of query but found %s", p.describe())
+	}
+	return result, nil
+}
+
+func (p *kqlParser) errorAt(pos int, format string, args ...interface{}) *KQLError {
+	return &KQLError{Query: p.query, Column: pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *kqlParser) errorf(format string, args ...interface{}) *KQLError {
+	return p.errorAt(p.pos, format, args...)
+}
+
+// Describes the input at the current position for error messages
+func (p *kqlParser) describe() string {
+	if p.eof() {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", p.input[p.pos])
+}
+
+func (p *kqlParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *kqlParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *kqlParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// Consumes the expected character (preceded by optional whitespace), returns error if it's not there
+func (p *kqlParser) expect(r rune) error {
+	p.skipSpace()
+	if p.eof() || p.peek() != r {
+		return p.errorf("expected %q but found %s", r, p.describe())
+	}
+	p.pos++
+	return nil
+}
+
+// Returns true if the keyword (case insensitive) is at the given position. Keyword needs to be followed by
+// whitespace, parenthesis or quote.
+func (p *kqlParser) isKeywordAt(pos int, keyword string) bool {
+	end := pos + len(keyword)
+	if end > len(p.input) || !strings.EqualFold(string(p.input[pos:end]), keyword) {
+		return false
+	}
+	return end == len(p.input) || unicode.IsSpace(p.input[end]) || p.input[end] == '(' || p.input[end] == '"'
+}
+
+// Consumes the keyword (preceded by optional whitespace) if it's next in the input
+func (p *kqlParser) keyword(keyword string) bool {
+	start := p.pos
+	p.skipSpace()
+	if p.isKeywordAt(p.pos, keyword) {
+		p.pos += len(keyword)
+		return true
+	}
+	p.pos = start
+	return false
+}
+
+// Parses operands separated by the keyword and combines them
+func (p *kqlParser) parseList(keyword string, operand func() (elastic.Query, error),
+	combine func(queries []elastic.Query) elastic.Query) (elastic.Query, error) {
+	query, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	queries := []elastic.Query{query}
+	for p.keyword(keyword) {
+		if query, err = operand(); err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	if len(queries) == 1 {
+		return query, nil
+	}
+	return combine(queries), nil
+}
+
+func kqlOr(queries []elastic.Query) elastic.Query {
+	return elastic.NewBoolQuery().Should(queries...).MinimumNumberShouldMatch(1)
+}
+
+func kqlAnd(queries []elastic.Query) elastic.Query {
+	return elastic.NewBoolQuery().Filter(queries...)
+}
+
+// Parses query, path is the prefix of field names (path of the nested field followed by a dot) within nested queries
+func (p *kqlParser) parseOr(path string) (elastic.Query, error) {
+	return p.parseList("or", func() (elastic.Query, error) { return p.parseAnd(path) }, kqlOr)
+}
+
+func (p *kqlParser) parseAnd(path string) (elastic.Query, error) {
+	return p.parseList("and", func() (elastic.Query, error) { return p.parseNot(path) }, kqlAnd)
+}
+
+func (p *kqlParser) parseNot(path string) (elastic.Query, error) {
+	if p.keyword("not") {
+		query, err := p.parseSub(path)
+		if err != nil {
+			return nil, err
+		}
+		return elastic.NewBoolQuery().MustNot(query), nil
+	}
+	return p.parseSub(path)
+}
+
+func (p *kqlParser) parseSub(path string) (elastic.Query, error) {
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.pos++
+		query, err := p.parseOr(path)
+		if err != nil {
+			return nil, err
+		}
+		return query, p.expect(')')
+	}
+	start := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	switch p.peek() {
+	case ':':
+		p.pos++
+		field, err := p.fieldName(value, start, path)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() == '{' {
+			p.pos++
+			query, err := p.parseOr(field + ".")
+			if err != nil {
+				return nil, err
+			}
+			return elastic.NewNestedQuery(field, query), p.expect('}')
+		}
+		return p.parseValueList(field)
+	case '<', '>':
+		field, err := p.fieldName(value, start, path)
+		if err != nil {
+			return nil, err
+		}
+		return p.parseRange(field)
+	}
+	return kqlValueQuery("", value), nil
+}
+
+func (p *kqlParser) fieldName(value *kqlValue, start int, path string) (string, error) {
+	if value.quoted || value.hasWildcard() && path != "" {
+		return "", p.errorAt(start, "invalid field name")
+	}
+	return path + value.String(), nil
+}
+
+func (p *kqlParser) parseRange(field string) (elastic.Query, error) {
+	op := string(p.input[p.pos])
+	p.pos++
+	if p.peek() == '=' {
+		op += "="
+		p.pos++
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	query := elastic.NewRangeQuery(field)
+	switch op {
+	case ">=":
+		query.Gte(value.String())
+	case ">":
+		query.Gt(value.String())
+	case "<=":
+		query.Lte(value.String())
+	case "<":
+		query.Lt(value.String())
+	}
+	return query, nil
+}
+
+// Parses value of the field, which may be a single value or values combined with or, and and not in parenthesis
+func (p *kqlParser) parseValueList(field string) (elastic.Query, error) {
+	p.skipSpace()
+	if p.peek() != '(' {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return kqlValueQuery(field, value), nil
+	}
+	p.pos++
+	var parseOr, parseAnd, parseNot func() (elastic.Query, error)
+	parseOr = func() (elastic.Query, error) { return p.parseList("or", parseAnd, kqlOr) }
+	parseAnd = func() (elastic.Query, error) { return p.parseList("and", parseNot, kqlAnd) }
+	parseNot = func() (elastic.Query, error) {
+		if p.keyword("not") {
+			query, err := p.parseValueList(field)
+			if err != nil {
+				return nil, err
+			}
+			return elastic.NewBoolQuery().MustNot(query), nil
+		}
+		return p.parseValueList(field)
+	}
+	query, err := parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return query, p.expect(')')
+}
+
+// Parses quoted or unquoted value
+func (p *kqlParser) parseValue() (*kqlValue, error) {
+	p.skipSpace()
+	if p.peek() == '"' {
+		return p.parseQuotedValue()
+	}
+	for _, keyword := range []string{"and", "or"} {
+		if p.isKeywordAt(p.pos, keyword) {
+			return nil, p.errorf("expected value but found keyword %s", keyword)
+		}
+	}
+	value := &kqlValue{}
+	for !p.eof() {
+		r := p.input[p.pos]
+		switch {
+		case r == '\\':
+			if p.pos+1 >= len(p.input) {
+				return nil, p.errorf("missing escaped character")
+			}
+			p.pos++
+			escaped := p.input[p.pos]
+			switch escaped {
+			case 't':
+				escaped = '\t'
+			case 'n':
+				escaped = '\n'
+			case 'r':
+				escaped = '\r'
+			}
+			value.chars = append(value.chars, kqlChar{r: escaped})
+		case unicode.IsSpace(r):
+			//whitespace is part of the value unless it's followed by special character, keyword or end of query
+			next := p.pos
+			for next < len(p.input) && unicode.IsSpace(p.input[next]) {
+				next++
+			}
+			if next == len(p.input) || strings.ContainsRune(kqlSpecialChars[1:], p.input[next]) ||
+				p.isKeywordAt(next, "and") || p.isKeywordAt(next, "or") || p.isKeywordAt(next, "not") {
+				return p.checkValue(value)
+			}
+			for ; p.pos < next; p.pos++ {
+				value.chars = append(value.chars, kqlChar{r: p.input[p.pos]})
+			}
+			continue
+		case strings.ContainsRune(kqlSpecialChars, r):
+			return p.checkValue(value)
+		default:
+			value.chars = append(value.chars, kqlChar{r: r, wildcard: r == '*'})
+		}
+		p.pos++
+	}
+	return p.checkValue(value)
+}
+
+func (p *kqlParser) checkValue(value *kqlValue) (*kqlValue, error) {
+	if len(value.chars) == 0 {
+		return nil, p.errorf("expected value but found %s", p.describe())
+	}
+	return value, nil
+}
+
+func (p *kqlParser) parseQuotedValue() (*kqlValue, error) {
+	start := p.pos
+	p.pos++
+	value := &kqlValue{quoted: true}
+	for ; !p.eof(); p.pos++ {
+		r := p.input[p.pos]
+		if r == '"' {
+			p.pos++
+			return value, nil
+		}
+		if r == '\\' && p.pos+1 < len(p.input) {
+			p.pos++
+			r = p.input[p.pos]
+		}
+		value.chars = append(value.chars, kqlChar{r: r})
+	}
+	return nil, p.errorAt(start, "unterminated quoted value")
+}
+
+// Builds query matching the value in the field (in any field if field is empty). Quoted values are matched as
+// phrases, unquoted values containing wildcards using query string query, and * alone matches if the field exists.
+func kqlValueQuery(field string, value *kqlValue) elastic.Query {
+	if !value.quoted && value.String() == "*" && value.hasWildcard() {
+		if field == "" {
+			return elastic.NewMatchAllQuery()
+		}
+		return elastic.NewExistsQuery(field)
+	}
+	if field == "" || strings.Contains(field, "*") || value.hasWildcard() {
+		query := elastic.NewQueryStringQuery(value.queryString()).AnalyzeWildcard(true)
+		if field != "" {
+			query = query.Field(field)
+		}
+		return query
+	}
+	if value.quoted {
+		return elastic.NewMatchPhraseQuery(field, value.String())
+	}
+	return elastic.NewMatchQuery(field, value.String())
+}
@@ -0,0 +1,89 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"os"
+	"testing"
+)
+
+func TestParseKQL(t *testing.T) {
+	tests := []struct {
+		kql   string
+		query string
+	}{
+		{"", `{"match_all":{}}`},
+		{"level:error", `{"match":{"level":{"query":"error"}}}`},
+		{"message:connection refused", `{"match":{"message":{"query":"connection refused"}}}`},
+		{`message:"connection refused"`, `{"match_phrase":{"message":{"query":"connection refused"}}}`},
+		{"host:web*", `{"query_string":{"analyze_wildcard":true,"fields":["host"],"query":"web*"}}`},
+		{`path:\/api\/v1*`, `{"query_string":{"analyze_wildcard":true,"fields":["path"],"query":"\\/api\\/v1*"}}`},
+		{"trace.id:*", `{"exists":{"field":"trace.id"}}`},
+		{"timeout", `{"query_string":{"analyze_wildcard":true,"query":"timeout"}}`},
+		{"status >= 500", `{"range":{"status":{"from":"500","include_lower":true,"include_upper":true,"to":null}}}`},
+		{"took<10", `{"range":{"took":{"from":null,"include_lower":true,"include_upper":false,"to":"10"}}}`},
+		{"level:(error or warn)",
+			`{"bool":{"minimum_should_match":"1","should":[{"match":{"level":{"query":"error"}}},{"match":{"level":{"query":"warn"}}}]}}`},
+		{"level:error OR level:warn and host:a",
+			`{"bool":{"minimum_should_match":"1","should":[{"match":{"level":{"query":"error"}}},` +
+				`{"bool":{"filter":[{"match":{"level":{"query":"warn"}}},{"match":{"host":{"query":"a"}}}]}}]}}`},
+		{"not (level:debug)", `{"bool":{"must_not":{"match":{"level":{"query":"debug"}}}}}`},
+		{"items:{ name:foo and price > 10 }",
+			`{"nested":{"path":"items","query":{"bool":{"filter":[{"match":{"items.name":{"query":"foo"}}},` +
+				`{"range":{"items.price":{"from":"10","include_lower":false,"include_upper":true,"to":null}}}]}}}}`},
+	}
+	for _, test := range tests {
+		query, err := ParseKQL(test.kql)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", test.kql, err)
+		}
+		tu.AssertEqualsString(t, test.query, querySource(t, query))
+	}
+}
+
+func TestParseKQLErrors(t *testing.T) {
+	tests := []struct {
+		kql    string
+		column int
+	}{
+		{"level:error and )", 17},
+		{`level:"error`, 7},
+		{"and level:error", 1},
+		{"(a or b", 8},
+		{"items:{a:b", 11},
+		{"status >= ", 11},
+		{"a:b c:d", 6},
+	}
+	for _, test := range tests {
+		_, err := ParseKQL(test.kql)
+		kqlErr, ok := err.(*KQLError)
+		if !ok {
+			t.Fatalf("Expected KQL error for %s, got %v", test.kql, err)
+		}
+		tu.AssertEqualsInt(t, test.column, kqlErr.Column)
+	}
+}
+
+func TestTermsQuery(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	query, err := (&QueryDefinition{Terms: []string{"level:error", "AND", "timeout"}}).TermsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, `{"query_string":{"query":"level:error AND timeout"}}`, querySource(t, query))
+
+	query, err = (&QueryDefinition{Terms: []string{"level:error", "AND", "timeout"}, QueryLanguage: queryLanguageKQL}).TermsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, `{"bool":{"filter":[{"match":{"level":{"query":"error"}}},`+
+		`{"query_string":{"analyze_wildcard":true,"query":"timeout"}}]}}`, querySource(t, query))
+
+	if _, err = (&QueryDefinition{QueryLanguage: "sql"}).TermsQuery(); err == nil {
+		tu.Fail(t, "Expected error for unknown query language")
+	}
+}
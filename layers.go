@@ -0,0 +1,221 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Names of the project configuration files, looked up in the current directory and its parents
+var projectConfFiles = []string{".elktail.yaml", ".elktail.yml", ".elktail.json"}
+
+const envLayerName = "environment variable"
+
+// ConfigLayer is a single source of configuration settings (e.g. environment variables or project file).
+// Values are keyed by setting key (see layeredSettings).
+type ConfigLayer struct {
+	Name   string
+	Values map[string]string
+}
+
+// Setting that may be specified in any of the configuration layers
+type layeredSetting struct {
+	Key   string                         //key used in project files, environment variable is derived from it
+	Flag  string                         //name of the command line flag for the setting
+	Value func(c *Configuration) *string //returns pointer to the setting's value in configuration
+}
+
+var layeredSettings = []layeredSetting{
+	{"url", "url", func(c *Configuration) *string { return &c.SearchTarget.Url }},
+	{"index-pattern", "i", func(c *Configuration) *string { return &c.SearchTarget.IndexPattern }},
+	{"index-strategy", "index-strategy", func(c *Configuration) *string { return &c.SearchTarget.IndexStrategy }},
+	{"index-date-format", "index-date-format", func(c *Configuration) *string { return &c.SearchTarget.IndexDateFormat }},
+	{"format", "f", func(c *Configuration) *string { return &c.QueryDefinition.Format }},
+	{"timestamp-field", "t", func(c *Configuration) *string { return &c.QueryDefinition.TimestampField }},
+	{"query-language", "query-language", func(c *Configuration) *string { return &c.QueryDefinition.QueryLanguage }},
+	{"user", "u", func(c *Configuration) *string { return &c.User }},
+	{"ssh-tunnel", "ssh", func(c *Configuration) *string { return &c.SSHTunnelParams }},
+}
+
+// Returns environment variable name for the setting key, e.g. ELKTAIL_INDEX_PATTERN for index-pattern
+func settingEnvVar(key string) string {
+	return "ELKTAIL_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// LoadConfigLayers returns configuration layers in order of precedence: explicitly set flags, environment variables,
+// project file, saved profile and built-in defaults. Given configuration should hold the values parsed from the
+// command line (which are built-in defaults for flags that were not set). Saved profile is not used if any of
+// the config relevant flags is set, since in that case the profile is being overwritten.
+func LoadConfigLayers(config *Configuration, isSet func(name string) bool) []ConfigLayer {
+	flags := ConfigLayer{Name: "command line flag", Values: map[string]string{}}
+	defaults := ConfigLayer{Name: "built-in default", Values: map[string]string{}}
+	for _, setting := range layeredSettings {
+		if isSet(setting.Flag) {
+			flags.Values[setting.Key] = *setting.Value(config)
+		} else {
+			defaults.Values[setting.Key] = *setting.Value(config)
+		}
+	}
+
+	layers := []ConfigLayer{flags, envConfigLayer()}
+
+	cwd, err := os.Getwd()
+	if err == nil {
+		project, err := projectConfigLayer(cwd)
+		if err != nil {
+			Error.Printf("Failed to load project configuration: %s\n", err)
+		} else if project != nil {
+			layers = append(layers, *project)
+		}
+	}
+
+	if !IsConfigRelevantFlagSet(isSet) {
+		if profile, err := LoadProfile(config.Profile); err == nil {
+			layers = append(layers, profileConfigLayer(config.Profile, profile))
+		}
+	}
+
+	return append(layers, defaults)
+}
+
+func envConfigLayer() ConfigLayer {
+	layer := ConfigLayer{Name: envLayerName, Values: map[string]string{}}
+	for _, setting := range layeredSettings {
+		if value, ok := os.LookupEnv(settingEnvVar(setting.Key)); ok {
+			layer.Values[setting.Key] = value
+		}
+	}
+	return layer
+}
+
+// Looks for project configuration file in the given directory and its parents and loads the first one found.
+// Returns nil if there is no project configuration file.
+func projectConfigLayer(dir string) (*ConfigLayer, error) {
+	for {
+		for _, name := range projectConfFiles {
+			file := filepath.Join(dir, name)
+			if _, err := os.Stat(file); err == nil {
+				values, err := loadProjectConfigFile(file)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", file, err)
+				}
+				return &ConfigLayer{Name: "project file " + file, Values: values}, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Loads YAML or JSON project configuration file. File is a map of setting keys to values, for example:
+//  index-pattern: app-[0-9].*
+//  format: "%@timestamp %level %message"
+func loadProjectConfigFile(file string) (map[string]string, error) {
+	fileBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if strings.HasSuffix(file, ".json") {
+		err = json.Unmarshal(fileBytes, &values)
+	} else {
+		err = yaml.Unmarshal(fileBytes, &values)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for key := range values {
+		if findLayeredSetting(key) == nil {
+			Error.Printf("Ignoring unknown setting %s in %s\n", key, file)
+			delete(values, key)
+		}
+	}
+	return values, nil
+}
+
+func profileConfigLayer(name string, profile *Configuration) ConfigLayer {
+	layer := ConfigLayer{Name: "profile " + name, Values: map[string]string{}}
+	for _, setting := range layeredSettings {
+		if value := *setting.Value(profile); value != "" {
+			layer.Values[setting.Key] = value
+		}
+	}
+	return layer
+}
+
+func findLayeredSetting(key string) *layeredSetting {
+	for i := range layeredSettings {
+		if layeredSettings[i].Key == key {
+			return &layeredSettings[i]
+		}
+	}
+	return nil
+}
+
+// ApplyLayers sets each of the layered settings to the value from the first layer that defines it. Returns the names
+// of the layers the values came from, keyed by setting key.
+func (c *Configuration) ApplyLayers(layers []ConfigLayer) map[string]string {
+	sources := make(map[string]string)
+	for _, setting := range layeredSettings {
+		for _, layer := range layers {
+			if value, ok := layer.Values[setting.Key]; ok {
+				*setting.Value(c) = value
+				sources[setting.Key] = layer.Name
+				break
+			}
+		}
+	}
+	return sources
+}
+
+// ApplyCommandLayers resolves the profile and applies configuration layers for commands (e.g. config or sql), which
+// use the global flags but never save them to the profile. Returns the names of the layers the values came from.
+func (c *Configuration) ApplyCommandLayers(ctx *cli.Context) map[string]string {
+	if c.Profile == "" {
+		c.Profile = LoadDefaultProfileName()
+	} else if err := validateProfileName(c.Profile); err != nil {
+		Error.Fatalln(err)
+	}
+	return c.ApplyLayers(LoadConfigLayers(c, ctx.GlobalIsSet))
+}
+
+// Returns the config command, which explains where effective configuration values come from
+func configCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "Inspect configuration",
+		Subcommands: []cli.Command{
+			{
+				Name:  "explain",
+				Usage: "Show effective configuration and which layer (flag, environment, project file, profile or default) each value came from",
+				Action: func(c *cli.Context) {
+					sources := config.ApplyCommandLayers(c)
+					writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+					fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE")
+					for _, setting := range layeredSettings {
+						source := sources[setting.Key]
+						if source == envLayerName {
+							source += " " + settingEnvVar(setting.Key)
+						}
+						fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.Key, *setting.Value(config), source)
+					}
+					writer.Flush()
+				},
+			},
+		},
+	}
+}
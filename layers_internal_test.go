@@ -0,0 +1,66 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyLayers(t *testing.T) {
+	config := new(Configuration)
+	sources := config.ApplyLayers([]ConfigLayer{
+		{Name: "flags", Values: map[string]string{"format": "%level %message"}},
+		{Name: "env", Values: map[string]string{"url": "http://ci:9200", "format": "%message"}},
+		{Name: "defaults", Values: map[string]string{"url": "http://127.0.0.1:9200", "format": "%message", "user": ""}},
+	})
+	tu.AssertEqualsString(t, "%level %message", config.QueryDefinition.Format)
+	tu.AssertEqualsString(t, "http://ci:9200", config.SearchTarget.Url)
+	tu.AssertEqualsString(t, "flags", sources["format"])
+	tu.AssertEqualsString(t, "env", sources["url"])
+	tu.AssertEqualsString(t, "defaults", sources["user"])
+}
+
+func TestProjectConfigLayer(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, true)
+	root, err := ioutil.TempDir("", "elktail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "service", "src")
+	os.MkdirAll(dir, 0700)
+
+	layer, err := projectConfigLayer(dir)
+	if err != nil || layer != nil {
+		tu.Fail(t, "Expected no project layer when there is no project file")
+	}
+
+	ioutil.WriteFile(filepath.Join(root, "service", ".elktail.yaml"),
+		[]byte("index-pattern: app-[0-9].*\nformat: \"%@timestamp %message\"\n"), 0600)
+	layer, err = projectConfigLayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "app-[0-9].*", layer.Values["index-pattern"])
+	tu.AssertEqualsString(t, "%@timestamp %message", layer.Values["format"])
+
+	ioutil.WriteFile(filepath.Join(dir, ".elktail.json"), []byte(`{"url": "http://elastic:9200"}`), 0600)
+	layer, err = projectConfigLayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "http://elastic:9200", layer.Values["url"])
+	tu.AssertEqualsInt(t, 1, len(layer.Values))
+}
+
+func TestSettingEnvVar(t *testing.T) {
+	tu.AssertEqualsString(t, "ELKTAIL_INDEX_PATTERN", settingEnvVar("index-pattern"))
+	tu.AssertEqualsString(t, "ELKTAIL_URL", settingEnvVar("url"))
+}
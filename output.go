@@ -0,0 +1,355 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntryFormatter formats search hit sources (entries) for output
+type EntryFormatter interface {
+	// Header returns the header line printed before the entries in list-only mode (empty if there is no header)
+	Header() string
+	// Format returns the formatted entry (without the trailing new line)
+	Format(entry map[string]interface{}) string
+}
+
+// documentFormatter is implemented by formatters whose output in list-only mode is a single document (e.g. JSON
+// array), opened by the header. Entries are separated with the separator and the document is closed by the footer.
+type documentFormatter interface {
+	Separator() string
+	Footer() string
+}
+
+// Writes formatted entries, one per line. In list-only mode, the header is written before the entries and the
+// entries of document formatters are separated and closed as the formatter requires (see Close).
+type entryWriter struct {
+	out       io.Writer
+	separator string
+	footer    string
+	written   int
+	closed    bool
+}
+
+// Creates entry writer for the formatter's entries, writing the header right away in list-only mode
+func newEntryWriter(out io.Writer, formatter EntryFormatter, listOnly bool) *entryWriter {
+	writer := &entryWriter{out: out}
+	if !listOnly {
+		return writer
+	}
+	if header := formatter.Header(); header != "" {
+		fmt.Fprintln(out, header)
+	}
+	if document, ok := formatter.(documentFormatter); ok {
+		writer.separator, writer.footer = document.Separator(), document.Footer()
+	}
+	return writer
+}
+
+// Write writes formatted entry. When entries are separated, the new line is written only once it's known whether
+// the separator needs to precede it.
+func (w *entryWriter) Write(line string) {
+	if w.separator == "" {
+		fmt.Fprintln(w.out, line)
+		return
+	}
+	if w.written > 0 {
+		fmt.Fprintln(w.out, w.separator)
+	}
+	fmt.Fprint(w.out, line)
+	w.written++
+}
+
+// Close finishes the output of the entries, writing the footer if there is one. Closing the writer again (e.g. when
+// interrupted just as the listing finished) writes nothing.
+func (w *entryWriter) Close() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.separator != "" && w.written > 0 {
+		fmt.Fprintln(w.out)
+	}
+	if w.footer != "" {
+		fmt.Fprintln(w.out, w.footer)
+	}
+}
+
+// Supported output modes
+const (
+	outputFormat = "format"
+	outputJson   = "json"
+	outputNdjson = "ndjson"
+	outputLogfmt = "logfmt"
+	outputCsv    = "csv"
+	outputTsv    = "tsv"
+)
+
+// NewEntryFormatter creates formatter for the output mode set in query definition. For the structured output modes,
+// fields to output are taken from query definition's field list, or, if it's empty, from the format (json and ndjson
+// output the whole entry in that case).
+func NewEntryFormatter(q *QueryDefinition) (EntryFormatter, error) {
+	if q.Template != "" {
+		if q.Output != "" && q.Output != outputFormat {
+			return nil, fmt.Errorf("Template can not be combined with %s output.", q.Output)
+		}
+		location, err := q.DisplayLocation()
+		if err != nil {
+			return nil, err
+		}
+		colorizer, err := NewColorizer(q)
+		if err != nil {
+			return nil, err
+		}
+		return newTemplateFormatter(q.Template, location, colorizer)
+	}
+	fields := q.OutputFields()
+	switch q.Output {
+	case "", outputFormat:
+		colorizer, err := NewColorizer(q)
+		if err != nil {
+			return nil, err
+		}
+		return &formatStringFormatter{format: q.Format, colorizer: colorizer}, nil
+	case outputJson:
+		return &jsonFormatter{fields: q.parseFields(), indent: true}, nil
+	case outputNdjson:
+		return &jsonFormatter{fields: q.parseFields()}, nil
+	case outputLogfmt:
+		return &logfmtFormatter{fields: fields}, nil
+	case outputCsv:
+		return &csvFormatter{fields: fields}, nil
+	case outputTsv:
+		return &tsvFormatter{fields: fields}, nil
+	}
+	return nil, fmt.Errorf("Unknown output mode %s (supported modes are format, json, ndjson, logfmt, csv and tsv).",
+		q.Output)
+}
+
+// DisplayLocation returns the time zone timestamps are displayed in - query definition's time zone if set, local
+// time zone otherwise
+func (q *QueryDefinition) DisplayLocation() (*time.Location, error) {
+	if q.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(q.TimeZone)
+}
+
+// OutputFields returns the fields selected for structured output - explicitly given fields or fields referenced
+// in the format
+func (q *QueryDefinition) OutputFields() []string {
+	if fields := q.parseFields(); len(fields) > 0 {
+		return fields
+	}
+	fields := make([]string, 0)
+	for _, f := range formatRegexp.FindAllString(q.Format, -1) {
+		fields = append(fields, f[1:])
+	}
+	return fields
+}
+
+func (q *QueryDefinition) parseFields() []string {
+	fields := make([]string, 0)
+	for _, f := range strings.Split(q.Fields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Formats entries using format string in which fields are referenced with % sign (e.g. '%@timestamp %message')
+type formatStringFormatter struct {
+	format    string
+	colorizer *Colorizer
+}
+
+func (f *formatStringFormatter) Header() string {
+	return ""
+}
+
+func (f *formatStringFormatter) Format(entry map[string]interface{}) string {
+	fields := formatRegexp.FindAllString(f.format, -1)
+	Trace.Println("Fields: ", fields)
+	result := f.format
+	for _, field := range fields {
+		value, _ := EvaluateExpression(entry, field[1:])
+		result = strings.Replace(result, field, f.colorizer.Value(field[1:], value), -1)
+	}
+	return f.colorizer.Line(entry, result)
+}
+
+// Formats entries as JSON objects, either the whole entry or only the selected fields (keyed by field expression).
+// Indented (json) output of the listed entries is a JSON array, while ndjson output is one object per line.
+type jsonFormatter struct {
+	fields []string
+	indent bool
+}
+
+func (f *jsonFormatter) Header() string {
+	if f.indent {
+		return "["
+	}
+	return ""
+}
+
+func (f *jsonFormatter) Separator() string {
+	if f.indent {
+		return ","
+	}
+	return ""
+}
+
+func (f *jsonFormatter) Footer() string {
+	if f.indent {
+		return "]"
+	}
+	return ""
+}
+
+func (f *jsonFormatter) Format(entry map[string]interface{}) string {
+	var value interface{} = entry
+	if len(f.fields) > 0 {
+		selected := make(map[string]interface{})
+		for _, field := range f.fields {
+			fieldValue, _ := EvaluateValue(entry, field)
+			selected[field] = fieldValue
+		}
+		value = selected
+	}
+	var result []byte
+	var err error
+	if f.indent {
+		result, err = json.MarshalIndent(value, "", "  ")
+	} else {
+		result, err = json.Marshal(value)
+	}
+	if err != nil {
+		Error.Printf("Failed to marshal entry to json: %s\n", err)
+	}
+	return string(result)
+}
+
+// Formats entries as logfmt key=value pairs, quoting values when necessary
+type logfmtFormatter struct {
+	fields []string
+}
+
+func (f *logfmtFormatter) Header() string {
+	return ""
+}
+
+func (f *logfmtFormatter) Format(entry map[string]interface{}) string {
+	pairs := make([]string, len(f.fields))
+	for i, field := range f.fields {
+		pairs[i] = field + "=" + logfmtValue(fieldString(entry, field))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	if strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f
+	}) >= 0 {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// Formats entries as CSV rows (RFC 4180 quoting) with header row containing field names
+type csvFormatter struct {
+	fields []string
+}
+
+func (f *csvFormatter) Header() string {
+	return f.row(f.fields)
+}
+
+func (f *csvFormatter) Format(entry map[string]interface{}) string {
+	values := make([]string, len(f.fields))
+	for i, field := range f.fields {
+		values[i] = fieldString(entry, field)
+	}
+	return f.row(values)
+}
+
+func (f *csvFormatter) row(values []string) string {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(values)
+	writer.Flush()
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// Formats entries as tab separated values with header row. Tabs, new lines and backslashes in values are escaped
+// as \t, \n, \r and \\ so that each entry is on a single line.
+type tsvFormatter struct {
+	fields []string
+}
+
+var tsvEscaper = strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (f *tsvFormatter) Header() string {
+	return f.row(f.fields)
+}
+
+func (f *tsvFormatter) Format(entry map[string]interface{}) string {
+	values := make([]string, len(f.fields))
+	for i, field := range f.fields {
+		values[i] = fieldString(entry, field)
+	}
+	return f.row(values)
+}
+
+func (f *tsvFormatter) row(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = tsvEscaper.Replace(value)
+	}
+	return strings.Join(escaped, "\t")
+}
+
+// Returns string representation of the entry's field suitable for structured output (see valueString). Missing
+// fields are output as empty string.
+func fieldString(entry map[string]interface{}, field string) string {
+	value, err := EvaluateValue(entry, field)
+	if err != nil {
+		return ""
+	}
+	return valueString(value)
+}
+
+// Returns string representation of the value: strings are output as they are, numbers without exponent notation,
+// objects and arrays as JSON and nil as empty string
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(dateFormatFull)
+	}
+	result, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(result)
+}
@@ -0,0 +1,82 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"testing"
+)
+
+func testEntry() map[string]interface{} {
+	return map[string]interface{}{
+		"@timestamp": "2016-06-17T15:00:00.000Z",
+		"level":      "ERROR",
+		"message":    "Connection failed: \"timeout\"\n\tat line 1",
+		"bytes":      float64(1048576),
+		"kubernetes": map[string]interface{}{
+			"pod": map[string]interface{}{"name": "api-7f9c"},
+		},
+	}
+}
+
+func formatEntry(t *testing.T, output string, fields string) string {
+	formatter, err := NewEntryFormatter(&QueryDefinition{Output: output, Fields: fields, Format: "%level %message"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return formatter.Format(testEntry())
+}
+
+func TestStructuredOutput(t *testing.T) {
+	tu.AssertEqualsString(t, `{"bytes":1048576,"kubernetes.pod.name":"api-7f9c","missing":null}`,
+		formatEntry(t, "ndjson", "bytes,kubernetes.pod.name,missing"))
+	tu.AssertEqualsString(t, `level=ERROR message="Connection failed: \"timeout\"\n\tat line 1"`,
+		formatEntry(t, "logfmt", ""))
+	tu.AssertEqualsString(t, `bytes=1048576 kubernetes.pod.name=api-7f9c missing=""`,
+		formatEntry(t, "logfmt", "bytes, kubernetes.pod.name, missing"))
+	tu.AssertEqualsString(t, "ERROR,\"Connection failed: \"\"timeout\"\"\n\tat line 1\"",
+		formatEntry(t, "csv", ""))
+	tu.AssertEqualsString(t, `ERROR	Connection failed: "timeout"\n\tat line 1`, formatEntry(t, "tsv", ""))
+	tu.AssertEqualsString(t, `{"pod":{"name":"api-7f9c"}}`, formatEntry(t, "tsv", "kubernetes"))
+
+	formatter, _ := NewEntryFormatter(&QueryDefinition{Output: "csv", Fields: "@timestamp,level"})
+	tu.AssertEqualsString(t, "@timestamp,level", formatter.Header())
+
+	if _, err := NewEntryFormatter(&QueryDefinition{Output: "xml"}); err == nil {
+		tu.Fail(t, "Expected error for unknown output mode")
+	}
+}
+
+func TestFormatStringOutput(t *testing.T) {
+	tu.AssertEqualsString(t, "ERROR api-7f9c",
+		(&formatStringFormatter{format: "%level %kubernetes.pod.name"}).Format(testEntry()))
+}
+
+func TestJsonOutputIsArray(t *testing.T) {
+	formatter, _ := NewEntryFormatter(&QueryDefinition{Output: "json", Fields: "level,message"})
+	for _, count := range []int{0, 1, 3} {
+		var out bytes.Buffer
+		writer := newEntryWriter(&out, formatter, true)
+		for i := 0; i < count; i++ {
+			writer.Write(formatter.Format(map[string]interface{}{"level": "ERROR", "message": "Connection refused"}))
+		}
+		writer.Close()
+		var entries []map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+			t.Fatalf("Output of %d entries is not valid JSON: %s\n%s", count, err, out.String())
+		}
+		tu.AssertEqualsInt(t, count, len(entries))
+	}
+
+	//when following, entries are output as they arrive, without the enclosing array
+	var out bytes.Buffer
+	writer := newEntryWriter(&out, formatter, false)
+	writer.Write(`{"level": "ERROR"}`)
+	writer.Close()
+	tu.AssertEqualsString(t, "{\"level\": \"ERROR\"}\n", out.String())
+}
@@ -0,0 +1,150 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// How long elasticsearch keeps the point in time (or scroll) used for exporting alive between two pages
+const exportKeepAlive = "5m"
+
+// Point in time (elasticsearch 7.10+) which makes all pages of an export see the same snapshot of the indices, even
+// if entries are being written to them while exporting
+type pointInTime struct {
+	id string
+}
+
+// Search result of the search within a point in time, which carries the (possibly updated) point in time id
+type pitSearchResult struct {
+	elastic.SearchResult
+	PitId string `json:"pit_id"`
+}
+
+// Opens a point in time for the selected indices
+func (tail *Tail) openPointInTime() (*pointInTime, error) {
+	params := url.Values{"keep_alive": {exportKeepAlive}}
+	if tail.lenientIndices {
+		params.Set("ignore_unavailable", "true")
+	}
+	escaped := make([]string, len(tail.indices))
+	for i, index := range tail.indices {
+		escaped[i] = url.PathEscape(index)
+	}
+	response, err := tail.client.PerformRequest(context.Background(), "POST",
+		"/"+strings.Join(escaped, ",")+"/_pit", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	var pit struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(response.Body, &pit); err != nil {
+		return nil, fmt.Errorf("Failed parsing point in time response: %s", err)
+	}
+	if pit.Id == "" {
+		return nil, fmt.Errorf("Point in time id is missing in the response.")
+	}
+	return &pointInTime{id: pit.Id}, nil
+}
+
+// Closes the point in time, releasing the resources held by elasticsearch
+func (tail *Tail) closePointInTime(pit *pointInTime) {
+	_, err := tail.client.PerformRequest(context.Background(), "DELETE", "/_pit", nil,
+		map[string]interface{}{"id": pit.id})
+	if err != nil {
+		Trace.Printf("Failed to close point in time: %s\n", err)
+	}
+}
+
+// Runs the search described by the search source within the point in time. Indices are not given, since the
+// point in time determines them.
+func (tail *Tail) searchPointInTime(pit *pointInTime, source *elastic.SearchSource) (*elastic.SearchResult, error) {
+	body, err := source.Source()
+	if err != nil {
+		return nil, err
+	}
+	request, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected search body %v", body)
+	}
+	request["pit"] = map[string]interface{}{"id": pit.id, "keep_alive": exportKeepAlive}
+	//total hits are returned as an object by elasticsearch 7+, which the search result can't be parsed from
+	params := url.Values{"rest_total_hits_as_int": {"true"}}
+	response, err := tail.client.PerformRequest(context.Background(), "POST", "/_search", params, request)
+	if err != nil {
+		return nil, err
+	}
+	var result pitSearchResult
+	if err := json.Unmarshal(response.Body, &result); err != nil {
+		return nil, fmt.Errorf("Failed parsing search response: %s", err)
+	}
+	if result.PitId != "" {
+		pit.id = result.PitId
+	}
+	return &result.SearchResult, nil
+}
+
+// Exports entries like export, using scroll instead of point in time, which is not supported by older clusters.
+// Scroll can't be combined with search_after, so when listing the last N entries, the entries preceding them are
+// skipped using the total number of hits in the scroll's snapshot.
+func (tail *Tail) scrollExport(query elastic.Query, entries int) (int, error) {
+	source := elastic.NewSearchSource().
+		Query(query).
+		SortBy(tail.pagingSorters(true, false)...)
+	if highlight := tail.highlighter.SearchHighlight(); highlight != nil {
+		source = source.Highlight(highlight)
+	}
+	scroll := tail.client.Scroll(tail.indices...).
+		SearchSource(source).
+		Size(exportPageSize).
+		KeepAlive(exportKeepAlive)
+	if tail.lenientIndices {
+		scroll = scroll.IgnoreUnavailable(true).AllowNoIndices(true)
+	}
+	defer func() {
+		if err := scroll.Clear(context.Background()); err != nil {
+			Trace.Printf("Failed to clear scroll: %s\n", err)
+		}
+	}()
+	fetched, skip := 0, -1
+	for entries <= 0 || fetched < entries {
+		result, err := scroll.Do(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fetched, err
+		}
+		if skip < 0 {
+			skip = 0
+			if !tail.order && entries > 0 && result.Hits.TotalHits > int64(entries) {
+				skip = int(result.Hits.TotalHits) - entries
+			}
+		}
+		hits := result.Hits.Hits
+		if skip > 0 {
+			skipped := skip
+			if skipped > len(hits) {
+				skipped = len(hits)
+			}
+			hits, skip = hits[skipped:], skip-skipped
+		}
+		if entries > 0 && len(hits) > entries-fetched {
+			hits = hits[:entries-fetched]
+		}
+		result.Hits.Hits = hits
+		tail.processResults(result, true)
+		fetched += len(hits)
+	}
+	return fetched, nil
+}
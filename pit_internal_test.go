@@ -0,0 +1,171 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Returns tail searching the given server, collecting the messages of the listed entries
+func exportTail(t *testing.T, url string, messages *[]string) *Tail {
+	client, err := elastic.NewClient(elastic.SetURL(url), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+	tail.output = func(entry map[string]interface{}) {
+		*messages = append(*messages, valueString(entry["message"]))
+	}
+	return tail
+}
+
+const exportHits = `[
+	{"_id": "1", "sort": [1, "1"], "_source": {"@timestamp": "2016-07-01T12:00:01.000Z", "message": "first"}},
+	{"_id": "2", "sort": [2, "2"], "_source": {"@timestamp": "2016-07-01T12:00:02.000Z", "message": "second"}}]`
+
+const pitHits = `[
+	{"_index": "logstash-2016.07.01", "_id": "1", "_score": null, "sort": [1467374401000, 3],
+		"_source": {"@timestamp": "2016-07-01T12:00:01.000Z", "message": "first"}},
+	{"_index": "logstash-2016.07.01", "_id": "2", "_score": null, "sort": [1467374402000, 4],
+		"_source": {"@timestamp": "2016-07-01T12:00:02.000Z", "message": "second"}}]`
+
+// Returns the search response of elasticsearch 7.x, which can't sort on _uid and returns total hits as an object
+// unless they are requested as a number
+func pitSearchResponse(r *http.Request, body string) string {
+	if strings.Contains(body, "_uid") {
+		return `{"error": {"type": "illegal_argument_exception", "reason": "No mapping found for [_uid] in order to sort on"}}`
+	}
+	total := `{"value": 2, "relation": "eq"}`
+	if r.URL.Query().Get("rest_total_hits_as_int") == "true" {
+		total = "2"
+	}
+	return `{"pit_id": "pit-1", "took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": {"total": ` + total + `, "max_score": null, "hits": ` + pitHits + `}}`
+}
+
+func TestExportPointInTime(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/_pit") && r.Method == "POST":
+			requests = append(requests, "open "+r.URL.Path)
+			w.Write([]byte(`{"id": "pit-1"}`))
+		case r.URL.Path == "/_pit":
+			requests = append(requests, "close "+string(body))
+			w.Write([]byte(`{"succeeded": true}`))
+		default:
+			requests = append(requests, "search "+r.URL.Path)
+			if !strings.Contains(string(body), `"pit":{"id":"pit-1","keep_alive":"5m"}`) {
+				tu.Fail(t, "Expected point in time in search body, got "+string(body))
+			}
+			w.Write([]byte(pitSearchResponse(r, string(body))))
+		}
+	}))
+	defer server.Close()
+	var messages []string
+	tail := exportTail(t, server.URL, &messages)
+
+	fetched, err := tail.export(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 2, fetched)
+	tu.AssertEqualsString(t, "first,second", strings.Join(messages, ","))
+	tu.AssertEqualsString(t, "open /logstash-2016.07.01,logstash-2016.07.02/_pit|search /_search|"+
+		`close {"id":"pit-1"}`, strings.Join(requests, "|"))
+}
+
+func TestExportScrollFallback(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	scrolled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/_pit"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "no handler found for uri"}`))
+		case r.URL.Path == "/_search/scroll" && r.Method == "DELETE":
+			w.Write([]byte(`{"succeeded": true}`))
+		case r.URL.Path == "/_search/scroll":
+			scrolled = true
+			w.Write([]byte(`{"_scroll_id": "scroll-1", "hits": {"total": 3, "hits": []}}`))
+		default:
+			w.Write([]byte(`{"_scroll_id": "scroll-1", "hits": {"total": 3, "hits": [
+				{"_id": "0", "_source": {"@timestamp": "2016-07-01T12:00:00.000Z", "message": "zeroth"}},
+				` + exportHits[1:] + `}}`))
+		}
+	}))
+	defer server.Close()
+	var messages []string
+	tail := exportTail(t, server.URL, &messages)
+
+	//last 2 of the 3 entries in the scroll are listed
+	fetched, err := tail.export(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 2, fetched)
+	tu.AssertEqualsString(t, "first,second", strings.Join(messages, ","))
+
+	messages = nil
+	if _, err := tail.export(0); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "zeroth,first,second", strings.Join(messages, ","))
+	if !scrolled {
+		tu.Fail(t, "Expected scrolling to the next page")
+	}
+}
+
+func TestExportScrollFallbackAfterPointInTime(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/_pit") && r.Method == "POST":
+			w.Write([]byte(`{"id": "pit-1"}`))
+		case r.URL.Path == "/_pit":
+			requests = append(requests, "close")
+			w.Write([]byte(`{"succeeded": true}`))
+		case r.URL.Path == "/_search":
+			requests = append(requests, "search")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "search within point in time failed"}`))
+		case r.URL.Path == "/_search/scroll":
+			w.Write([]byte(`{"succeeded": true}`))
+		default:
+			requests = append(requests, "scroll")
+			w.Write([]byte(`{"_scroll_id": "scroll-1", "hits": {"total": 2, "hits": ` + exportHits + `}}`))
+		}
+	}))
+	defer server.Close()
+	var messages []string
+	tail := exportTail(t, server.URL, &messages)
+
+	//nothing was listed within the point in time, so the export is repeated using scroll
+	fetched, err := tail.export(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 2, fetched)
+	tu.AssertEqualsString(t, "first,second", strings.Join(messages, ","))
+	tu.AssertEqualsString(t, "search|close|scroll", strings.Join(requests, "|"))
+}
@@ -0,0 +1,218 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Name of the profile used if no profile is specified and no other default profile is configured. Profile
+// named default is stored in default.json, which is where elktail used to store its (only) configuration.
+var defaultProfile = "default"
+
+// File holding the name of the configured default profile
+var defaultProfileFile = "default-profile"
+
+var profileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+func profileFile(profile string) string {
+	return userHomeDir() + string(os.PathSeparator) + confDir + string(os.PathSeparator) + profile + ".json"
+}
+
+func validateProfileName(profile string) error {
+	if !profileNameRegexp.MatchString(profile) {
+		return fmt.Errorf("Invalid profile name '%s' (only letters, digits, '.', '_' and '-' are allowed).", profile)
+	}
+	return nil
+}
+
+// LoadDefaultProfileName returns the name of the configured default profile
+func LoadDefaultProfileName() string {
+	nameBytes, err := ioutil.ReadFile(userHomeDir() + string(os.PathSeparator) + confDir +
+		string(os.PathSeparator) + defaultProfileFile)
+	if err != nil {
+		return defaultProfile
+	}
+	name := strings.TrimSpace(string(nameBytes))
+	if validateProfileName(name) != nil {
+		return defaultProfile
+	}
+	return name
+}
+
+// SaveDefaultProfileName configures the profile used when no profile is specified
+func SaveDefaultProfileName(profile string) error {
+	confDirPath, err := ensureConfDir()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(confDirPath+string(os.PathSeparator)+defaultProfileFile, []byte(profile+"\n"), 0600)
+}
+
+// ListProfiles returns sorted names of all saved profiles
+func ListProfiles() ([]string, error) {
+	confDirPath, err := ensureConfDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(confDirPath + string(os.PathSeparator) + "*.json")
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]string, 0, len(files))
+	for _, file := range files {
+		profiles = append(profiles, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// DeleteProfile deletes the saved profile. If the profile was configured as default, default profile is reset.
+func DeleteProfile(profile string) error {
+	if err := os.Remove(profileFile(profile)); err != nil {
+		return err
+	}
+	if profile == LoadDefaultProfileName() {
+		//default profile name may not be saved at all, in which case there is nothing to reset
+		err := os.Remove(userHomeDir() + string(os.PathSeparator) + confDir + string(os.PathSeparator) +
+			defaultProfileFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyProfile saves the copy of profile src under name dest. Existing profile dest is overwritten only if force
+// is set.
+func CopyProfile(src string, dest string, force bool) error {
+	config, err := LoadProfile(src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(profileFile(dest)); err == nil && !force {
+		return fmt.Errorf("Profile %s already exists (use --force to overwrite it).", dest)
+	}
+	return config.SaveProfile(dest)
+}
+
+// Returns the profile command with subcommands for managing saved profiles
+func profileCommand() cli.Command {
+	return cli.Command{
+		Name:  "profile",
+		Usage: "Manage connection profiles (list, show, delete, copy, default)",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List saved profiles, default profile is marked with *",
+				Action: listProfilesAction,
+			},
+			{
+				Name:      "show",
+				Usage:     "Show the settings saved in the profile",
+				ArgsUsage: "[profile]",
+				Action:    showProfileAction,
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete the profile",
+				ArgsUsage: "<profile>",
+				Action:    deleteProfileAction,
+			},
+			{
+				Name:      "copy",
+				Usage:     "Copy the profile under a new name",
+				ArgsUsage: "<profile> <new-profile>",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "force",
+						Usage: "Overwrite the new profile if it already exists",
+					},
+				},
+				Action: copyProfileAction,
+			},
+			{
+				Name:      "default",
+				Usage:     "Set the profile used when --profile option is not specified",
+				ArgsUsage: "<profile>",
+				Action:    defaultProfileAction,
+			},
+		},
+	}
+}
+
+func listProfilesAction(c *cli.Context) {
+	profiles, err := ListProfiles()
+	if err != nil {
+		Error.Fatalln("Failed to list profiles.", err)
+	}
+	defaultName := LoadDefaultProfileName()
+	for _, profile := range profiles {
+		marker := " "
+		if profile == defaultName {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, profile)
+	}
+}
+
+func showProfileAction(c *cli.Context) {
+	profile := LoadDefaultProfileName()
+	if c.Args().Present() {
+		profile = profileArg(c, 0)
+	}
+	config, err := LoadProfile(profile)
+	if err != nil {
+		Error.Fatalf("Failed to load profile %s: %s\n", profile, err)
+	}
+	confJs, _ := json.MarshalIndent(config, "", "  ")
+	fmt.Println(string(confJs))
+}
+
+func deleteProfileAction(c *cli.Context) {
+	profile := profileArg(c, 0)
+	if err := DeleteProfile(profile); err != nil {
+		Error.Fatalf("Failed to delete profile %s: %s\n", profile, err)
+	}
+}
+
+func copyProfileAction(c *cli.Context) {
+	src := profileArg(c, 0)
+	dest := profileArg(c, 1)
+	if err := CopyProfile(src, dest, c.Bool("force")); err != nil {
+		Error.Fatalf("Failed to copy profile %s: %s\n", src, err)
+	}
+}
+
+func defaultProfileAction(c *cli.Context) {
+	profile := profileArg(c, 0)
+	if _, err := os.Stat(profileFile(profile)); err != nil {
+		Error.Fatalf("Profile %s does not exist.\n", profile)
+	}
+	if err := SaveDefaultProfileName(profile); err != nil {
+		Error.Fatalf("Failed to set default profile: %s\n", err)
+	}
+}
+
+// Returns validated profile name given as i-th command argument
+func profileArg(c *cli.Context, i int) string {
+	profile := c.Args().Get(i)
+	if profile == "" {
+		Error.Fatalln("Missing profile name argument.")
+	}
+	if err := validateProfileName(profile); err != nil {
+		Error.Fatalln(err)
+	}
+	return profile
+}
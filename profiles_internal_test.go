@@ -0,0 +1,75 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, true)
+	home, err := ioutil.TempDir("", "elktail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	tu.AssertEqualsString(t, "default", LoadDefaultProfileName())
+
+	config := new(Configuration)
+	config.SearchTarget.Url = "http://prod.example.com:9200"
+	config.QueryDefinition.TimestampField = "timestamp"
+	if err := config.SaveProfile("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyProfile("prod", "staging", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyProfile("prod", "staging", false); err == nil {
+		tu.Fail(t, "Expected error when copying over existing profile")
+	}
+	if err := CopyProfile("prod", "staging", true); err != nil {
+		t.Fatal(err)
+	}
+	profiles, _ := ListProfiles()
+	tu.AssertEqualsString(t, "prod,staging", strings.Join(profiles, ","))
+
+	loaded, err := LoadProfile("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "http://prod.example.com:9200", loaded.SearchTarget.Url)
+	tu.AssertEqualsString(t, "timestamp", loaded.QueryDefinition.TimestampField)
+
+	if err := SaveDefaultProfileName("staging"); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "staging", LoadDefaultProfileName())
+	if err := DeleteProfile("staging"); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "default", LoadDefaultProfileName())
+	profiles, _ = ListProfiles()
+	tu.AssertEqualsString(t, "prod", strings.Join(profiles, ","))
+
+	//default profile name is not saved, deleting the default profile succeeds anyway
+	if err := CopyProfile("prod", "default", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteProfile("default"); err != nil {
+		t.Fatal(err)
+	}
+
+	if validateProfileName("../prod") == nil {
+		tu.Fail(t, "Expected profile name with path separators to be invalid")
+	}
+}
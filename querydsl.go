@@ -0,0 +1,97 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Query DSL source reading the query from standard input
+const queryDSLStdin = "-"
+
+// LoadQueryDSL loads raw elasticsearch query given inline, from file (if source starts with @) or from the given
+// reader (if source is -). Query may be given either as the query itself (e.g. {"terms": {...}}) or as the search
+// body containing it (e.g. {"query": {"terms": {...}}}).
+func LoadQueryDSL(source string, stdin io.Reader) (elastic.Query, error) {
+	body, err := ReadQueryDSL(source, stdin)
+	if err != nil {
+		return nil, err
+	}
+	return elastic.NewRawStringQuery(body), nil
+}
+
+// ReadQueryDSL reads raw elasticsearch query like LoadQueryDSL and returns the query itself as JSON
+func ReadQueryDSL(source string, stdin io.Reader) (string, error) {
+	var queryBytes []byte
+	var err error
+	switch {
+	case source == queryDSLStdin:
+		queryBytes, err = ioutil.ReadAll(stdin)
+	case strings.HasPrefix(source, "@"):
+		queryBytes, err = ioutil.ReadFile(source[1:])
+	default:
+		queryBytes = []byte(source)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read query DSL: %s", err)
+	}
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal(queryBytes, &query); err != nil {
+		return "", fmt.Errorf("Invalid query DSL: %s", err)
+	}
+	if body, ok := query["query"]; ok && len(query) == 1 {
+		query = nil
+		if err := json.Unmarshal(body, &query); err != nil {
+			return "", fmt.Errorf("Invalid query DSL: %s", err)
+		}
+	}
+	if len(query) != 1 {
+		return "", fmt.Errorf("Invalid query DSL: expected object with a single query, found %d keys.", len(query))
+	}
+	result, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// LoadQueryDSLBody reads the query DSL from the source given with --query-dsl into QueryDSLBody. Query DSL is read
+// only once, since standard input can't be read again (e.g. by the tails of several clusters).
+func (q *QueryDefinition) LoadQueryDSLBody(stdin io.Reader) error {
+	if q.QueryDSL == "" || q.QueryDSLBody != "" {
+		return nil
+	}
+	body, err := ReadQueryDSL(q.QueryDSL, stdin)
+	if err != nil {
+		return err
+	}
+	q.QueryDSLBody = body
+	return nil
+}
+
+// BaseQuery returns the query that is extended with field filters and date range filters - query built from the query
+// terms, or raw query DSL (combined with the query terms, if there are any)
+func (q *QueryDefinition) BaseQuery() (elastic.Query, error) {
+	termsQuery, err := q.TermsQuery()
+	if err != nil || q.QueryDSL == "" {
+		return termsQuery, err
+	}
+	if err := q.LoadQueryDSLBody(os.Stdin); err != nil {
+		return nil, err
+	}
+	dslQuery := elastic.NewRawStringQuery(q.QueryDSLBody)
+	Trace.Printf("Running query DSL: %s", dslQuery)
+	if len(q.Terms) == 0 {
+		return dslQuery, nil
+	}
+	return elastic.NewBoolQuery().Filter(dslQuery, termsQuery), nil
+}
@@ -0,0 +1,85 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadQueryDSL(t *testing.T) {
+	expected := `{"terms":{"host":["web-1","web-2"]}}`
+	query, err := LoadQueryDSL(`{"query": {"terms": {"host": ["web-1", "web-2"]}}}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, expected, querySource(t, query))
+
+	query, err = LoadQueryDSL("-", strings.NewReader(`{"terms": {"host": ["web-1", "web-2"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, expected, querySource(t, query))
+
+	dir, err := ioutil.TempDir("", "elktail-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "query.json")
+	if err := ioutil.WriteFile(file, []byte(`{"exists": {"field": "trace.id"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	query, err = LoadQueryDSL("@"+file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, `{"exists":{"field":"trace.id"}}`, querySource(t, query))
+
+	for _, invalid := range []string{`{"terms": `, `{}`, `{"match_all": {}, "exists": {"field": "x"}}`, "@" + file + ".missing"} {
+		if _, err := LoadQueryDSL(invalid, nil); err == nil {
+			tu.Fail(t, "Expected error for "+invalid)
+		}
+	}
+}
+
+func TestBaseQuery(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	query, err := (&QueryDefinition{Terms: []string{"timeout"}, QueryDSL: `{"exists": {"field": "trace.id"}}`}).BaseQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, `{"bool":{"filter":[{"exists":{"field":"trace.id"}},{"query_string":{"query":"timeout"}}]}}`,
+		querySource(t, query))
+}
+
+func TestQueryDSLReadOnce(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	config := new(Configuration)
+	config.QueryDefinition.QueryDSL = queryDSLStdin
+	if err := config.QueryDefinition.LoadQueryDSLBody(strings.NewReader(`{"query": {"term": {"host": "web-1"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	//configurations of several tails (e.g. of several clusters) use the query read from standard input
+	for _, tailConfig := range []*Configuration{config.Copy(), config.Copy()} {
+		query, err := tailConfig.QueryDefinition.BaseQuery()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tu.AssertEqualsString(t, `{"term":{"host":"web-1"}}`, querySource(t, query))
+	}
+
+	other := new(Configuration)
+	other.QueryDefinition.QueryDSL = queryDSLStdin
+	other.QueryDefinition.LoadQueryDSLBody(strings.NewReader(`{"term": {"host": "web-2"}}`))
+	if checkpointKey(config) == checkpointKey(other) {
+		tu.Fail(t, "Expected different checkpoint keys for different queries read from standard input")
+	}
+}
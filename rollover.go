@@ -0,0 +1,180 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"sort"
+	"time"
+)
+
+// Index selection strategies (see --index-strategy)
+const (
+	indexStrategyDate     = "date"
+	indexStrategyRollover = "rollover"
+	indexStrategyAlias    = "alias"
+	indexStrategyWildcard = "wildcard"
+)
+
+const indexRangeLayout = "2006-01-02 15:04:05"
+
+// Time range covered by an index, as determined from the timestamps of its entries
+type indexRange struct {
+	index   string
+	created time.Time //creation date of the index
+	start   time.Time //timestamp of the oldest entry
+	end     time.Time //timestamp of the newest entry, zero if the index is empty
+}
+
+func (r indexRange) String() string {
+	if r.end.IsZero() {
+		return fmt.Sprintf("empty (created %s)", r.created.UTC().Format(indexRangeLayout))
+	}
+	return fmt.Sprintf("%s - %s", r.start.UTC().Format(indexRangeLayout), r.end.UTC().Format(indexRangeLayout))
+}
+
+// Returns whether the index may contain entries between start and end (zero end means there is no upper bound).
+// Empty indices created before the end are included, since they may be the current write index of a rollover alias.
+func (r indexRange) overlaps(start, end time.Time) bool {
+	if r.end.IsZero() {
+		return end.IsZero() || r.created.Before(end)
+	}
+	return (end.IsZero() || !r.start.After(end)) && !r.end.Before(start)
+}
+
+// Lists indices (with their health, size and creation date) matching the index expression (an index name, alias,
+// data stream or wildcard expression), or all of the indices if the expression is empty
+func (tail *Tail) catIndices(index string) (elastic.CatIndicesResponse, error) {
+	return tail.client.CatIndices().
+		Index(index).
+		Columns("index", "health", "status", "docs.count", "store.size", "creation.date", "creation.date.string").
+		Do(context.Background())
+}
+
+// Determines time ranges covered by the indices, using min and max of the timestamp field in each of them. If
+// expression (e.g. alias or wildcard expression) is given, it's searched instead of listing the indices by name.
+func (tail *Tail) indexRanges(indices elastic.CatIndicesResponse, expression string) ([]indexRange, error) {
+	ranges := make([]indexRange, 0, len(indices))
+	if len(indices) == 0 {
+		return ranges, nil
+	}
+	names := []string{expression}
+	if expression == "" {
+		names = make([]string, len(indices))
+		for i, index := range indices {
+			names[i] = index.Index
+		}
+	}
+	field := tail.queryDefinition.TimestampField
+	result, err := tail.client.Search().
+		Index(names...).
+		AllowNoIndices(true).
+		IgnoreUnavailable(true).
+		Size(0).
+		Aggregation("indices", elastic.NewTermsAggregation().Field("_index").Size(len(indices)).
+			SubAggregation("start", elastic.NewMinAggregation().Field(field)).
+			SubAggregation("end", elastic.NewMaxAggregation().Field(field))).
+		Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	terms, found := result.Aggregations.Terms("indices")
+	if !found {
+		return nil, fmt.Errorf("Index aggregation is missing in the response.")
+	}
+	bounds := make(map[string]indexRange)
+	for _, bucket := range terms.Buckets {
+		start, _ := bucket.Min("start")
+		end, _ := bucket.Max("end")
+		if start == nil || start.Value == nil || end == nil || end.Value == nil {
+			continue
+		}
+		bounds[valueString(bucket.Key)] = indexRange{start: epochMillis(*start.Value), end: epochMillis(*end.Value)}
+	}
+	for _, index := range indices {
+		r := bounds[index.Index]
+		r.index = index.Index
+		r.created = epochMillis(float64(index.CreationDate))
+		ranges = append(ranges, r)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].created.Before(ranges[j].created) })
+	return ranges, nil
+}
+
+func epochMillis(millis float64) time.Time {
+	return time.Unix(0, int64(millis)*int64(time.Millisecond)).UTC()
+}
+
+// Selects indices that may contain entries between start and end. If start is zero, the index with the most recent
+// entries is selected (along with any empty indices created after the oldest entry in it).
+func selectIndexRanges(ranges []indexRange, start, end time.Time) []string {
+	if start.IsZero() {
+		for _, r := range ranges {
+			if r.end.After(start) && (end.IsZero() || !r.end.After(end)) {
+				start = r.end
+			}
+		}
+	}
+	result := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.overlaps(start, end) {
+			result = append(result, r.index)
+		}
+	}
+	return result
+}
+
+// Selects indices matching the index pattern by the time range of their entries, which is used for rollover
+// indices whose names do not contain dates
+func (tail *Tail) selectRolloverIndices(configuration *Configuration) error {
+	indices, err := tail.catIndices("")
+	if err != nil {
+		return fmt.Errorf("Could not fetch available indices: %s", err)
+	}
+	patterns, err := ParseIndexPatterns(configuration.SearchTarget.IndexPattern)
+	if err != nil {
+		return err
+	}
+	matching := indices[:0]
+	for _, index := range indices {
+		if patterns.Matches(index.Index) {
+			matching = append(matching, index)
+		}
+	}
+	ranges, err := tail.indexRanges(matching, "")
+	if err != nil {
+		return fmt.Errorf("Could not determine time ranges of the indices: %s", err)
+	}
+	startDate := configuration.QueryDefinition.AfterDateTime
+	if startDate == "" {
+		startDate = tail.lastTimeStamp
+	}
+	var start, end time.Time
+	if startDate != "" {
+		start = parseElasticTimeStamp(startDate)
+	}
+	if configuration.QueryDefinition.BeforeDateTime != "" {
+		end = parseElasticTimeStamp(configuration.QueryDefinition.BeforeDateTime)
+	}
+	//indices are selected for each of the patterns, so that the latest index of each one is used
+	tail.indices = make([]string, 0)
+	for i := range patterns.Include {
+		patternRanges := make([]indexRange, 0, len(ranges))
+		for _, r := range ranges {
+			if patterns.MatchesInclude(i, r.index) {
+				patternRanges = append(patternRanges, r)
+			}
+		}
+		for _, index := range selectIndexRanges(patternRanges, start, end) {
+			if !containsString(tail.indices, index) {
+				tail.indices = append(tail.indices, index)
+			}
+		}
+	}
+	return nil
+}
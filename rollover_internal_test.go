@@ -0,0 +1,78 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rolloverTime(value string) time.Time {
+	parsed, _ := time.Parse(indexRangeLayout, value)
+	return parsed
+}
+
+func testIndexRanges() []indexRange {
+	return []indexRange{
+		{index: "logs-app-000001", created: rolloverTime("2024-05-01 00:00:00"),
+			start: rolloverTime("2024-05-01 00:00:05"), end: rolloverTime("2024-05-02 10:00:00")},
+		{index: "logs-app-000002", created: rolloverTime("2024-05-02 10:00:00"),
+			start: rolloverTime("2024-05-02 10:00:01"), end: rolloverTime("2024-05-03 12:00:00")},
+		{index: "logs-app-000003", created: rolloverTime("2024-05-03 12:00:00"),
+			start: rolloverTime("2024-05-03 12:00:02"), end: rolloverTime("2024-05-04 08:30:00")},
+		{index: "logs-app-000004", created: rolloverTime("2024-05-04 08:30:00")},
+	}
+}
+
+func TestSelectIndexRanges(t *testing.T) {
+	ranges := testIndexRanges()
+	tu.AssertEqualsString(t, "logs-app-000003,logs-app-000004",
+		strings.Join(selectIndexRanges(ranges, time.Time{}, time.Time{}), ","))
+	tu.AssertEqualsString(t, "logs-app-000001,logs-app-000002",
+		strings.Join(selectIndexRanges(ranges, rolloverTime("2024-05-02 08:00:00"),
+			rolloverTime("2024-05-02 12:00:00")), ","))
+	tu.AssertEqualsString(t, "logs-app-000003,logs-app-000004",
+		strings.Join(selectIndexRanges(ranges, rolloverTime("2024-05-04 00:00:00"), time.Time{}), ","))
+	tu.AssertEqualsString(t, "logs-app-000002,logs-app-000003",
+		strings.Join(selectIndexRanges(ranges, time.Time{}, rolloverTime("2024-05-03 13:00:00")), ","))
+	tu.AssertEqualsString(t, "",
+		strings.Join(selectIndexRanges(ranges, rolloverTime("2024-04-01 00:00:00"),
+			rolloverTime("2024-04-02 00:00:00")), ","))
+}
+
+func TestIndexRanges(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hits": {"total": 10, "hits": []}, "aggregations": {"indices": {"buckets": [
+			{"key": "logs-app-000001", "doc_count": 7, "start": {"value": 1714521605000}, "end": {"value": 1714644000000}}
+		]}}}`))
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+
+	ranges, err := tail.indexRanges(elastic.CatIndicesResponse{
+		{Index: "logs-app-000002", CreationDate: 1714644000000},
+		{Index: "logs-app-000001", CreationDate: 1714521600000},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 2, len(ranges))
+	tu.AssertEqualsString(t, "logs-app-000001", ranges[0].index)
+	tu.AssertEqualsString(t, "2024-05-01 00:00:05 - 2024-05-02 10:00:00", ranges[0].String())
+	tu.AssertEqualsString(t, "empty (created 2024-05-02 10:00:00)", ranges[1].String())
+}
@@ -0,0 +1,263 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"gopkg.in/olivere/elastic.v5"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Supported output formats of the sql command
+const (
+	sqlOutputTable = "table"
+	sqlOutputCsv   = "csv"
+	sqlOutputJson  = "json"
+)
+
+// Number of rows fetched per request by default, further rows are fetched using the cursor
+const sqlFetchSize = 1000
+
+// SQLColumn describes column of the SQL query result
+type SQLColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SQLResponse is a single page of the SQL query result. Columns are only returned on the first page, cursor is
+// empty on the last one.
+type SQLResponse struct {
+	Columns []SQLColumn     `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	Cursor  string          `json:"cursor"`
+}
+
+// Writes SQL query results as they are fetched
+type sqlWriter interface {
+	Columns(columns []SQLColumn)
+	Rows(rows [][]interface{})
+	Close()
+}
+
+func newSQLWriter(output string, out io.Writer) (sqlWriter, error) {
+	switch output {
+	case "", sqlOutputTable:
+		return &sqlTableWriter{writer: tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)}, nil
+	case sqlOutputCsv:
+		return &sqlCsvWriter{out: out}, nil
+	case sqlOutputJson:
+		return &sqlJsonWriter{out: out}, nil
+	}
+	return nil, fmt.Errorf("Unknown SQL output format %s (supported formats are table, csv and json).", output)
+}
+
+// Writes results as a table with columns aligned. Since the column widths depend on all the values, the table is
+// printed once all of the rows are fetched.
+type sqlTableWriter struct {
+	writer *tabwriter.Writer
+}
+
+func (w *sqlTableWriter) Columns(columns []SQLColumn) {
+	names := make([]string, len(columns))
+	separators := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = tsvEscaper.Replace(column.Name)
+		separators[i] = strings.Repeat("-", len(names[i]))
+	}
+	fmt.Fprintln(w.writer, strings.Join(names, "\t"))
+	fmt.Fprintln(w.writer, strings.Join(separators, "\t"))
+}
+
+func (w *sqlTableWriter) Rows(rows [][]interface{}) {
+	for _, row := range rows {
+		values := make([]string, len(row))
+		for i, value := range row {
+			values[i] = tsvEscaper.Replace(valueString(value))
+		}
+		fmt.Fprintln(w.writer, strings.Join(values, "\t"))
+	}
+}
+
+func (w *sqlTableWriter) Close() {
+	w.writer.Flush()
+}
+
+// Writes results as CSV with header row containing column names
+type sqlCsvWriter struct {
+	out io.Writer
+	csv csvFormatter
+}
+
+func (w *sqlCsvWriter) Columns(columns []SQLColumn) {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	fmt.Fprintln(w.out, w.csv.row(names))
+}
+
+func (w *sqlCsvWriter) Rows(rows [][]interface{}) {
+	for _, row := range rows {
+		values := make([]string, len(row))
+		for i, value := range row {
+			values[i] = valueString(value)
+		}
+		fmt.Fprintln(w.out, w.csv.row(values))
+	}
+}
+
+func (w *sqlCsvWriter) Close() {
+}
+
+// Writes results as JSON array of objects keyed by column names (in the order of the columns)
+type sqlJsonWriter struct {
+	out     io.Writer
+	columns []string
+	written int
+}
+
+func (w *sqlJsonWriter) Columns(columns []SQLColumn) {
+	for _, column := range columns {
+		name, _ := json.Marshal(column.Name)
+		w.columns = append(w.columns, string(name))
+	}
+	fmt.Fprint(w.out, "[")
+}
+
+func (w *sqlJsonWriter) Rows(rows [][]interface{}) {
+	for _, row := range rows {
+		var buffer bytes.Buffer
+		if w.written > 0 {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("\n  {")
+		for i, value := range row {
+			if i > 0 {
+				buffer.WriteString(", ")
+			}
+			valueJson, err := json.Marshal(value)
+			if err != nil {
+				valueJson, _ = json.Marshal(valueString(value))
+			}
+			buffer.WriteString(w.columns[i] + ": ")
+			buffer.Write(valueJson)
+		}
+		buffer.WriteString("}")
+		w.out.Write(buffer.Bytes())
+		w.written++
+	}
+}
+
+func (w *sqlJsonWriter) Close() {
+	if w.written > 0 {
+		fmt.Fprintln(w.out)
+	}
+	fmt.Fprintln(w.out, "]")
+}
+
+// Returns path of the SQL endpoint - _sql since elasticsearch 7, _xpack/sql in 6.3 to 6.8
+func sqlEndpoint(client *elastic.Client) (string, error) {
+	response, err := client.PerformRequest(context.Background(), "GET", "/", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(response.Body, &info); err != nil {
+		return "", fmt.Errorf("Failed to determine elasticsearch version: %s", err)
+	}
+	parts := strings.Split(info.Version.Number, ".")
+	major, _ := strconv.Atoi(parts[0])
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	switch {
+	case major >= 7:
+		return "/_sql", nil
+	case major == 6 && minor >= 3:
+		return "/_xpack/sql", nil
+	}
+	return "", fmt.Errorf("SQL queries require elasticsearch 6.3 or newer (version %s found).", info.Version.Number)
+}
+
+// RunSQL runs the SQL query and writes the results, fetching all the pages of the result using the cursor
+func RunSQL(client *elastic.Client, query string, fetchSize int, writer sqlWriter) error {
+	endpoint, err := sqlEndpoint(client)
+	if err != nil {
+		return err
+	}
+	params := url.Values{"format": []string{"json"}}
+	body := map[string]interface{}{"query": query, "fetch_size": fetchSize}
+	for {
+		Trace.Printf("Running SQL request: %v", body)
+		response, err := client.PerformRequest(context.Background(), "POST", endpoint, params, body)
+		if err != nil {
+			return err
+		}
+		var result SQLResponse
+		if err := json.Unmarshal(response.Body, &result); err != nil {
+			return fmt.Errorf("Failed parsing SQL response: %s", err)
+		}
+		if result.Columns != nil {
+			writer.Columns(result.Columns)
+		}
+		writer.Rows(result.Rows)
+		if result.Cursor == "" {
+			writer.Close()
+			return nil
+		}
+		body = map[string]interface{}{"cursor": result.Cursor}
+	}
+}
+
+// Returns the sql command, which runs SQL query using elasticsearch SQL and prints the result
+func sqlCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:      "sql",
+		Usage:     "Run SQL query using elasticsearch SQL (requires elasticsearch 6.3 or newer)",
+		ArgsUsage: "<query>",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "o,output",
+				Value: sqlOutputTable,
+				Usage: "Output format - table, csv or json",
+			},
+			cli.IntFlag{
+				Name:  "fetch-size",
+				Value: sqlFetchSize,
+				Usage: "Number of rows fetched per request, further rows are fetched using cursor",
+			},
+		},
+		Action: func(c *cli.Context) {
+			query := strings.Join(c.Args(), " ")
+			if strings.TrimSpace(query) == "" {
+				Error.Fatalln(`Missing SQL query (example: elktail sql "SELECT host, count(*) FROM \"logstash-*\" GROUP BY host").`)
+			}
+			writer, err := newSQLWriter(c.String("output"), os.Stdout)
+			if err != nil {
+				Error.Fatalln(err)
+			}
+			config.ApplyCommandLayers(c)
+			prepareConnection(config)
+			if err := RunSQL(NewClient(config), query, c.Int("fetch-size"), writer); err != nil {
+				Error.Fatalln(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,83 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+var testSQLColumns = []SQLColumn{{Name: "host", Type: "keyword"}, {Name: "count(*)", Type: "long"}}
+
+func TestSQLWriters(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{"table", "host   count(*)\n----   --------\nweb-1  12\nweb-2  3\n"},
+		{"csv", "host,count(*)\nweb-1,12\nweb-2,3\n"},
+		{"json", "[\n  {\"host\": \"web-1\", \"count(*)\": 12},\n  {\"host\": \"web-2\", \"count(*)\": 3}\n]\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		writer, err := newSQLWriter(test.output, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Columns(testSQLColumns)
+		writer.Rows([][]interface{}{{"web-1", float64(12)}})
+		writer.Rows([][]interface{}{{"web-2", float64(3)}})
+		writer.Close()
+		tu.AssertEqualsString(t, test.expected, out.String())
+	}
+	if _, err := newSQLWriter("xml", nil); err == nil {
+		tu.Fail(t, "Expected error for unknown output format")
+	}
+}
+
+func TestRunSQL(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	requests := make([]map[string]interface{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`{"version": {"number": "6.8.2"}}`))
+		case "/_xpack/sql":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			requests = append(requests, body)
+			if body["cursor"] == nil {
+				json.NewEncoder(w).Encode(SQLResponse{Columns: testSQLColumns,
+					Rows: [][]interface{}{{"web-1", 12}}, Cursor: "c1"})
+			} else {
+				json.NewEncoder(w).Encode(SQLResponse{Rows: [][]interface{}{{"web-2", 3}}})
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	writer, _ := newSQLWriter("csv", &out)
+	if err := RunSQL(client, "SELECT host, count(*) FROM logs GROUP BY host", 1, writer); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "host,count(*)\nweb-1,12\nweb-2,3\n", out.String())
+	tu.AssertEqualsInt(t, 2, len(requests))
+	tu.AssertEqualsString(t, "SELECT host, count(*) FROM logs GROUP BY host", requests[0]["query"].(string))
+	tu.AssertEqualsString(t, "c1", requests[1]["cursor"].(string))
+}
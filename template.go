@@ -0,0 +1,153 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats entries using Go text/template executed over the entry (hit source). Besides the standard template
+// functions, the following helpers are available:
+//  get "dotted.path"     - value of the (nested) field, e.g. {{get "kubernetes.pod.name"}}
+//  date "layout" value   - formats timestamp using Go time layout, e.g. {{get "@timestamp" | date "15:04:05"}}
+//  local value           - converts timestamp to local time zone (or to --tz time zone if given)
+//  pad n value           - pads value with spaces to n characters (on the left if n is negative)
+//  trunc n value         - truncates value to n characters
+//  upper value           - converts value to upper case
+//  json value            - formats value as JSON
+//  default def value     - def if value is missing or empty, value otherwise
+//  color "name" value    - colors the value (black, red, green, yellow, blue, magenta, cyan, white, gray, bold, dim
+//                          or inverse), if colors are enabled
+type templateFormatter struct {
+	template  *template.Template
+	location  *time.Location
+	colorizer *Colorizer
+}
+
+// Creates template formatter from template text, or, if text starts with @, from the template in the given file
+func newTemplateFormatter(text string, location *time.Location, colorizer *Colorizer) (*templateFormatter, error) {
+	if strings.HasPrefix(text, "@") {
+		templateBytes, err := ioutil.ReadFile(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		text = string(templateBytes)
+	}
+	formatter := &templateFormatter{location: location, colorizer: colorizer}
+	tmpl, err := template.New("entry").Funcs(formatter.funcs()).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	formatter.template = tmpl
+	return formatter, nil
+}
+
+func (f *templateFormatter) Header() string {
+	return ""
+}
+
+// Format executes the template over the entry. The template is cloned so that get function can be bound to the
+// entry, which keeps the formatter safe for use from several goroutines.
+func (f *templateFormatter) Format(entry map[string]interface{}) string {
+	var buffer bytes.Buffer
+	tmpl, err := f.template.Clone()
+	if err == nil {
+		err = tmpl.Funcs(template.FuncMap{"get": entryGetter(entry)}).Execute(&buffer, entry)
+	}
+	if err != nil {
+		Error.Printf("Failed to execute template: %s\n", err)
+	}
+	return f.colorizer.Line(entry, strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+// Returns get template function for the entry
+func entryGetter(entry map[string]interface{}) func(field string) interface{} {
+	return func(field string) interface{} {
+		value, _ := EvaluateValue(entry, field)
+		return value
+	}
+}
+
+func (f *templateFormatter) funcs() template.FuncMap {
+	return template.FuncMap{
+		"get": entryGetter(nil),
+		"date": func(layout string, value interface{}) string {
+			if t, ok := templateTime(value); ok {
+				return t.Format(layout)
+			}
+			return valueString(value)
+		},
+		"local": func(value interface{}) interface{} {
+			if t, ok := templateTime(value); ok {
+				return t.In(f.location)
+			}
+			return value
+		},
+		"pad": func(width int, value interface{}) string {
+			str := valueString(value)
+			padding := width
+			if padding < 0 {
+				padding = -padding
+			}
+			padding -= utf8.RuneCountInString(str)
+			if padding <= 0 {
+				return str
+			}
+			if width < 0 {
+				return strings.Repeat(" ", padding) + str
+			}
+			return str + strings.Repeat(" ", padding)
+		},
+		"trunc": func(length int, value interface{}) string {
+			str := valueString(value)
+			if utf8.RuneCountInString(str) <= length {
+				return str
+			}
+			return string([]rune(str)[:length])
+		},
+		"upper": func(value interface{}) string {
+			return strings.ToUpper(valueString(value))
+		},
+		"json": func(value interface{}) string {
+			result, err := json.Marshal(value)
+			if err != nil {
+				return valueString(value)
+			}
+			return string(result)
+		},
+		"default": func(def interface{}, value interface{}) interface{} {
+			if value == nil || valueString(value) == "" {
+				return def
+			}
+			return value
+		},
+		"color": func(color string, value interface{}) (string, error) {
+			if _, ok := ansiColors[color]; !ok {
+				return "", fmt.Errorf("unknown color %s", color)
+			}
+			return f.colorizer.Color(color, valueString(value)), nil
+		},
+	}
+}
+
+// Converts template value to time - value may be time or timestamp string in elasticsearch's date format
+func templateTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(dateFormatFull, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
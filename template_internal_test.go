@@ -0,0 +1,57 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	tu "github.com/knes1/elktail/testutils"
+	"sync"
+	"testing"
+	"time"
+)
+
+func executeTemplate(t *testing.T, text string) string {
+	formatter, err := newTemplateFormatter(text, time.FixedZone("CEST", 2*60*60), &Colorizer{enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return formatter.Format(testEntry())
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	tu.AssertEqualsString(t, "17:00:00 ERROR |", executeTemplate(t, `{{get "@timestamp" | local | date "15:04:05"}} {{.level | pad 6}}|`))
+	tu.AssertEqualsString(t, " ERROR|api|API-7F9C", executeTemplate(t, `{{get "level" | pad -6}}|{{get "kubernetes.pod.name" | trunc 3}}|{{get "kubernetes.pod.name" | upper}}`))
+	tu.AssertEqualsString(t, "-|1048576", executeTemplate(t, `{{get "user" | default "-"}}|{{get "bytes" | default "-" | json}}`))
+	tu.AssertEqualsString(t, "\x1b[31mERROR\x1b[0m", executeTemplate(t, `{{color "red" .level}}`))
+	tu.AssertEqualsString(t, "error", executeTemplate(t, "{{if eq .level \"ERROR\"}}error{{else}}other{{end}}\n"))
+	tu.AssertEqualsString(t, `{"name":"api-7f9c"}`, executeTemplate(t, `{{get "kubernetes.pod" | json}}`))
+
+	if _, err := newTemplateFormatter("{{get", time.UTC, nil); err == nil {
+		tu.Fail(t, "Expected template parse error")
+	}
+}
+
+func TestTemplateFormatterConcurrentUse(t *testing.T) {
+	formatter, err := newTemplateFormatter(`{{get "message"}}`, time.UTC, &Colorizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				message := fmt.Sprintf("%d-%d", i, j)
+				if formatted := formatter.Format(map[string]interface{}{"message": message}); formatted != message {
+					tu.Fail(t, "Expected "+message+", got "+formatted)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,176 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts accepted for absolute date-time expressions. Expressions without time zone are interpreted in the
+// time zone given to ParseTimeExpression.
+var absoluteTimeLayouts = []string{
+	"2006-01-02T15:04:05.999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Layouts accepted for time of day part of expressions like "yesterday 18:00"
+var timeOfDayLayouts = []string{
+	"15:04:05",
+	"15:04",
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+	"sun":       time.Sunday,
+	"mon":       time.Monday,
+	"tue":       time.Tuesday,
+	"wed":       time.Wednesday,
+	"thu":       time.Thursday,
+	"fri":       time.Friday,
+	"sat":       time.Saturday,
+}
+
+// Regexp for durations such as 15m or 2h (meaning 15 minutes ago or 2 hours ago)
+var durationRegexp = regexp.MustCompile(`^(\d+)([smhdwMy])$`)
+
+// Regexp for date math operations following "now", for example -2h in now-2h
+var dateMathRegexp = regexp.MustCompile(`([+-])(\d+)([smhdwMy])`)
+
+// ParseTimeExpression resolves absolute or relative time expression into absolute time. Supported expressions are:
+// "2016-06-17T15:00" (absolute date and optional time, interpreted in the given location),
+// "15m", "2h", "3d" (duration before now - units are s, m, h, d, w, M and y),
+// "now", "now-2h", "now-1d+30m" (date math relative to now),
+// "today", "yesterday", "monday", "mon" (start of the day, weekday refers to the most recent such day),
+// "yesterday 18:00", "monday 09:30" (day expression followed by time of day) and
+// "18:00" (time of day today).
+func ParseTimeExpression(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	now = now.In(loc)
+
+	if t, err := time.Parse(time.RFC3339Nano, expr); err == nil {
+		return t, nil
+	}
+	for _, layout := range absoluteTimeLayouts {
+		if t, err := time.ParseInLocation(layout, expr, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	if match := durationRegexp.FindStringSubmatch(expr); match != nil {
+		amount, _ := strconv.Atoi(match[1])
+		return addTimeUnits(now, -amount, match[2]), nil
+	}
+
+	if strings.HasPrefix(expr, "now") {
+		return parseDateMath(expr, now)
+	}
+
+	if t, ok := parseTimeOfDay(expr, startOfDay(now)); ok {
+		return t, nil
+	}
+
+	parts := strings.Fields(strings.ToLower(expr))
+	if len(parts) == 0 || len(parts) > 2 {
+		return time.Time{}, fmt.Errorf("Unrecognized date-time expression: %s", expr)
+	}
+	day, ok := parseDay(parts[0], now)
+	if !ok {
+		return time.Time{}, fmt.Errorf("Unrecognized date-time expression: %s", expr)
+	}
+	if len(parts) == 1 {
+		return day, nil
+	}
+	if t, ok := parseTimeOfDay(parts[1], day); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Unrecognized time of day in expression: %s", expr)
+}
+
+// Parses expressions of form now[+-N<unit>]...
+func parseDateMath(expr string, now time.Time) (time.Time, error) {
+	ops := expr[len("now"):]
+	result := now
+	matches := dateMathRegexp.FindAllStringSubmatchIndex(ops, -1)
+	pos := 0
+	for _, m := range matches {
+		if m[0] != pos {
+			break
+		}
+		amount, _ := strconv.Atoi(ops[m[4]:m[5]])
+		if ops[m[2]:m[3]] == "-" {
+			amount = -amount
+		}
+		result = addTimeUnits(result, amount, ops[m[6]:m[7]])
+		pos = m[1]
+	}
+	if pos != len(ops) {
+		return time.Time{}, fmt.Errorf("Unrecognized date math expression: %s", expr)
+	}
+	return result, nil
+}
+
+// Resolves day expressions - today, yesterday and weekday names - to the start of the day
+func parseDay(expr string, now time.Time) (time.Time, bool) {
+	today := startOfDay(now)
+	switch expr {
+	case "today":
+		return today, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+	if weekday, ok := weekdays[expr]; ok {
+		daysAgo := (int(now.Weekday()) - int(weekday) + 7) % 7
+		return today.AddDate(0, 0, -daysAgo), true
+	}
+	return time.Time{}, false
+}
+
+func parseTimeOfDay(expr string, day time.Time) (time.Time, bool) {
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.Parse(layout, expr); err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, day.Location()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func addTimeUnits(t time.Time, amount int, unit string) time.Time {
+	switch unit {
+	case "s":
+		return t.Add(time.Duration(amount) * time.Second)
+	case "m":
+		return t.Add(time.Duration(amount) * time.Minute)
+	case "h":
+		return t.Add(time.Duration(amount) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, amount)
+	case "w":
+		return t.AddDate(0, 0, 7*amount)
+	case "M":
+		return t.AddDate(0, amount, 0)
+	case "y":
+		return t.AddDate(amount, 0, 0)
+	}
+	return t
+}
@@ -0,0 +1,57 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"testing"
+	"time"
+)
+
+func TestParseTimeExpression(t *testing.T) {
+	//Wednesday
+	now := time.Date(2016, 6, 15, 10, 30, 0, 0, time.UTC)
+	tu.AssertEqualsString(t, "2016-06-17T15:00:00Z", parseExpr(t, "2016-06-17T15:00", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-17T00:00:00Z", parseExpr(t, "2016-06-17", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-15T10:15:00Z", parseExpr(t, "15m", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-15T08:30:00Z", parseExpr(t, "now-2h", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-14T11:00:00Z", parseExpr(t, "now-1d+30m", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-15T10:30:00Z", parseExpr(t, "now", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-15T00:00:00Z", parseExpr(t, "today", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-14T18:00:00Z", parseExpr(t, "yesterday 18:00", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-13T00:00:00Z", parseExpr(t, "monday", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-15T00:00:00Z", parseExpr(t, "Wednesday", now, time.UTC))
+	tu.AssertEqualsString(t, "2016-06-15T08:00:00Z", parseExpr(t, "08:00", now, time.UTC))
+
+	zagreb := time.FixedZone("CEST", 2*60*60)
+	tu.AssertEqualsString(t, "2016-06-17T13:00:00Z", parseExpr(t, "2016-06-17T15:00", now, zagreb))
+	tu.AssertEqualsString(t, "2016-06-14T16:00:00Z", parseExpr(t, "yesterday 18:00", now, zagreb))
+
+	for _, invalid := range []string{"soon", "now-2x", "yesterday noon", "15 m"} {
+		if _, err := ParseTimeExpression(invalid, now, time.UTC); err == nil {
+			tu.Fail(t, "Expected error for expression "+invalid)
+		}
+	}
+}
+
+func TestResolveDateTimes(t *testing.T) {
+	now := time.Date(2016, 6, 15, 10, 30, 0, 0, time.UTC)
+	q := QueryDefinition{AfterDateTime: "1h", BeforeDateTime: "2016-06-15T12:00", TimeZone: "UTC"}
+	if err := q.ResolveDateTimes(now); err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsString(t, "2016-06-15T09:30:00Z", q.AfterDateTime)
+	tu.AssertEqualsString(t, "2016-06-15T12:00:00Z", q.BeforeDateTime)
+	tu.AssertEqualsString(t, "2016-06-15", extractYMDDate(q.AfterDateTime, "-").Format(dateFormatDMY))
+}
+
+func parseExpr(t *testing.T, expr string, now time.Time, loc *time.Location) string {
+	result, err := ParseTimeExpression(expr, now, loc)
+	if err != nil {
+		t.Errorf("Failed parsing %s: %s", expr, err)
+	}
+	return result.UTC().Format(time.RFC3339)
+}
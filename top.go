@@ -0,0 +1,144 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"gopkg.in/olivere/elastic.v5"
+	"text/tabwriter"
+	"time"
+)
+
+// ANSI sequence that moves the cursor to the top left corner and clears the screen, used for refreshing in watch mode
+const clearScreen = "\x1b[H\x1b[2J"
+
+// TopTerm is a value of the field and the number of matching entries having it
+type TopTerm struct {
+	Value string
+	Count int64
+}
+
+// TopResult holds the most frequent values of the field among the matching entries
+type TopResult struct {
+	Field   string
+	Terms   []TopTerm
+	Other   int64 //number of entries with values other than the top ones
+	Missing int64 //number of entries without the field
+	Total   int64 //number of matching entries
+}
+
+// Top runs terms aggregation returning k most frequent values of the field among the entries matching the query,
+// filters and date range in the selected indices
+func (tail *Tail) Top(field string, k int) (*TopResult, error) {
+	result, err := tail.search().
+		Query(tail.buildSearchQuery()).
+		Size(0).
+		Aggregation("top", elastic.NewTermsAggregation().Field(field).Size(k)).
+		Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	terms, found := result.Aggregations.Terms("top")
+	if !found {
+		return nil, fmt.Errorf("Terms aggregation is missing in the response.")
+	}
+	top := &TopResult{Field: field, Other: terms.SumOfOtherDocCount, Total: result.Hits.TotalHits}
+	top.Missing = top.Total - top.Other
+	for _, bucket := range terms.Buckets {
+		top.Terms = append(top.Terms, TopTerm{Value: valueString(bucket.Key), Count: bucket.DocCount})
+		top.Missing -= bucket.DocCount
+	}
+	if top.Missing < 0 {
+		//fields with multiple values are counted once per value
+		top.Missing = 0
+	}
+	return top, nil
+}
+
+// Render returns ranked table of the top values with counts and percentages of the matching entries
+func (r *TopResult) Render() string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "RANK\t%s\tCOUNT\tPERCENT\n", r.Field)
+	for i, term := range r.Terms {
+		fmt.Fprintf(writer, "%d\t%s\t%d\t%s\n", i+1, tsvEscaper.Replace(term.Value), term.Count, r.percent(term.Count))
+	}
+	if r.Other > 0 {
+		fmt.Fprintf(writer, "\t(other)\t%d\t%s\n", r.Other, r.percent(r.Other))
+	}
+	if r.Missing > 0 {
+		fmt.Fprintf(writer, "\t(missing)\t%d\t%s\n", r.Missing, r.percent(r.Missing))
+	}
+	writer.Flush()
+	buffer.WriteString(fmt.Sprintf("Total: %d\n", r.Total))
+	return buffer.String()
+}
+
+func (r *TopResult) percent(count int64) string {
+	if r.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(count)*100/float64(r.Total))
+}
+
+// Returns the top command, which prints the most frequent values of the field among the matching entries
+func topCommand(config *Configuration) cli.Command {
+	return cli.Command{
+		Name:      "top",
+		Usage:     "Show the most frequent values of the field among the entries matching the query, filters and date range",
+		ArgsUsage: "<field> [query-string]",
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "k",
+				Value: 10,
+				Usage: "Number of values to show",
+			},
+			cli.BoolFlag{
+				Name:  "watch",
+				Usage: "Refresh the table periodically until interrupted (relative date ranges move with time)",
+			},
+			cli.DurationFlag{
+				Name:  "interval",
+				Value: 2 * time.Second,
+				Usage: "Refresh interval in watch mode",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if !c.Args().Present() {
+				Error.Fatalln("Missing field name (example: elktail top host level:error).")
+			}
+			field := c.Args().First()
+			//unresolved date expressions are kept so that relative ranges can be re-evaluated on each refresh
+			after, before := config.QueryDefinition.AfterDateTime, config.QueryDefinition.BeforeDateTime
+			prepareConfiguration(config, globalFlags(c), c.Args().Tail())
+			tail := NewTail(config)
+			for {
+				top, err := tail.Top(field, c.Int("k"))
+				if err != nil {
+					Error.Fatalln("Error in executing terms aggregation.", err)
+				}
+				if !c.Bool("watch") {
+					fmt.Print(top.Render())
+					return
+				}
+				fmt.Printf("%sEvery %s: elktail top %s    %s\n\n%s", clearScreen, c.Duration("interval"), field,
+					time.Now().Format("2006-01-02 15:04:05"), top.Render())
+				time.Sleep(c.Duration("interval"))
+
+				config.QueryDefinition.AfterDateTime, config.QueryDefinition.BeforeDateTime = after, before
+				if err := config.QueryDefinition.ResolveDateTimes(time.Now()); err != nil {
+					Error.Fatalf("Invalid date-time filter: %s\n", err)
+				}
+				if err := tail.selectIndices(config); err != nil {
+					Error.Fatalln(err)
+				}
+			}
+		},
+	}
+}
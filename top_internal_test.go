@@ -0,0 +1,43 @@
+/* Copyright (C) 2016 Krešimir Nesek
+ *
+ * This software may be modified and distributed under the terms
+ * of the MIT license. See the LICENSE file for details.
+ */
+package main
+
+import (
+	tu "github.com/knes1/elktail/testutils"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestTop(t *testing.T) {
+	InitLogging(os.Stderr, os.Stderr, os.Stderr, false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hits": {"total": 200, "hits": []}, "aggregations": {"top": {"sum_other_doc_count": 30,
+			"buckets": [{"key": "web-1", "doc_count": 120}, {"key": "web-2", "doc_count": 40}]}}}`))
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := dryRunTail()
+	tail.client = client
+
+	top, err := tail.Top("host", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.AssertEqualsInt(t, 10, int(top.Missing))
+	tu.AssertEqualsString(t, ""+
+		"RANK  host       COUNT  PERCENT\n"+
+		"1     web-1      120    60.0%\n"+
+		"2     web-2      40     20.0%\n"+
+		"      (other)    30     15.0%\n"+
+		"      (missing)  10     5.0%\n"+
+		"Total: 200\n", top.Render())
+}